@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// JSON API unter /api/v1/. Spiegelt die HTML-Handler, liefert aber JSON und
+// einheitliche Fehlerobjekte: {"error": {"code": "...", "message": "..."}}.
+
+type apiErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiRepository struct {
+	ID              string     `json:"id"`
+	Path            string     `json:"path"`
+	NoLock          bool       `json:"no_lock"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	LastAccessAt    *time.Time `json:"last_access_at,omitempty"`
+	LastSuccessAt   *time.Time `json:"last_success_at,omitempty"`
+	LastAccessError string     `json:"last_access_error,omitempty"`
+	LastCheckAt     *time.Time `json:"last_check_at,omitempty"`
+	LastCheckStatus string     `json:"last_check_status,omitempty"`
+	LastCheckMsg    string     `json:"last_check_message,omitempty"`
+}
+
+type apiFileEntry struct {
+	Name            string    `json:"name"`
+	Path            string    `json:"path"`
+	IsDir           bool      `json:"is_dir"`
+	Size            int64     `json:"size"`
+	ModTime         time.Time `json:"mod_time"`
+	IsRepo          bool      `json:"is_repo"`
+	RepoID          string    `json:"repo_id,omitempty"`
+	RepoConfigured  bool      `json:"repo_configured"`
+	LastCheckStatus string    `json:"last_check_status,omitempty"`
+}
+
+type apiFilesResponse struct {
+	Path    string         `json:"path"`
+	Parent  *string        `json:"parent"`
+	Entries []apiFileEntry `json:"entries"`
+}
+
+type apiJob struct {
+	ID           string     `json:"id"`
+	Kind         string     `json:"kind"`
+	RepoID       string     `json:"repo_id"`
+	Status       string     `json:"status"`
+	Params       JobParams  `json:"params"`
+	Progress     float64    `json:"progress"`
+	ProgressText string     `json:"progress_text,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	ArtifactName string     `json:"artifact_name,omitempty"`
+	ArtifactSize int64      `json:"artifact_size,omitempty"`
+	ArtifactURL  string     `json:"artifact_url,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+type apiListResponse struct {
+	Snapshot string    `json:"snapshot"`
+	Path     string    `json:"path"`
+	Entries  []LsEntry `json:"entries"`
+}
+
+func (a *App) registerAPI(mux *http.ServeMux) {
+	routes := []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/api/v1/repositories", a.apiRepositories},
+		{"/api/v1/repositories/{repo}", a.apiRepository},
+		{"/api/v1/repositories/{repo}/snapshots", a.apiSnapshots},
+		{"/api/v1/repositories/{repo}/snapshots/{snap}/ls", a.apiList},
+		{"/api/v1/repositories/{repo}/stats", a.apiStats},
+		{"/api/v1/files", a.apiFiles},
+		{"/api/v1/jobs", a.apiJobs},
+		{"/api/v1/jobs/{id}", a.apiJob},
+	}
+
+	// known dient nur dazu, im Catch-all bekannte Pfade mit falscher Methode
+	// zu erkennen (405 statt 404)
+	known := http.NewServeMux()
+	for _, rt := range routes {
+		mux.HandleFunc("GET "+rt.path, rt.handler)
+		known.HandleFunc(rt.path, func(http.ResponseWriter, *http.Request) {})
+	}
+
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := known.Handler(r); pattern != "" {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method "+r.Method+" is not allowed, use GET")
+			return
+		}
+		writeAPIError(w, http.StatusNotFound, "not_found", "unknown API endpoint")
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("api: write json failed: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, apiError{Error: apiErrorBody{Code: code, Message: msg}})
+}
+
+// writeResticAPIError bildet die bekannten restic-Fehler auf Status Codes ab.
+func writeResticAPIError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrResticNotFound):
+		writeAPIError(w, http.StatusServiceUnavailable, "restic_not_found", err.Error())
+	case errors.Is(err, ErrWrongPassword):
+		writeAPIError(w, http.StatusBadGateway, "wrong_password", err.Error())
+	case errors.Is(err, ErrNotARepository):
+		writeAPIError(w, http.StatusBadGateway, "not_a_repository", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "restic_failed", err.Error())
+	}
+}
+
+func toAPIRepository(r RepoConfig) apiRepository {
+	out := apiRepository{
+		ID:              r.ID,
+		Path:            redactRepository(r.Path),
+		NoLock:          r.NoLock,
+		CreatedAt:       r.CreatedAt,
+		UpdatedAt:       r.UpdatedAt,
+		LastAccessError: r.LastAccessError,
+		LastCheckStatus: r.LastCheckStatus,
+		LastCheckMsg:    r.LastCheckMessage,
+	}
+	if !r.LastAccessAt.IsZero() {
+		out.LastAccessAt = &r.LastAccessAt
+	}
+	if !r.LastSuccessAt.IsZero() {
+		out.LastSuccessAt = &r.LastSuccessAt
+	}
+	if !r.LastCheckAt.IsZero() {
+		out.LastCheckAt = &r.LastCheckAt
+	}
+	return out
+}
+
+// apiRepo lädt das Repository aus dem Pfad oder schreibt einen 404/500 Fehler.
+func (a *App) apiRepo(w http.ResponseWriter, r *http.Request) (RepoConfig, bool) {
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "config_error", err.Error())
+		return RepoConfig{}, false
+	}
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "repository_not_found", "repository "+repoID+" is not configured")
+		return RepoConfig{}, false
+	}
+	return repo, true
+}
+
+func (a *App) apiRepositories(w http.ResponseWriter, r *http.Request) {
+	repos, err := a.store.List(r.Context())
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "config_error", err.Error())
+		return
+	}
+	out := make([]apiRepository, 0, len(repos))
+	for _, repo := range repos {
+		out = append(out, toAPIRepository(repo))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *App) apiRepository(w http.ResponseWriter, r *http.Request) {
+	repo, ok := a.apiRepo(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIRepository(repo))
+}
+
+func (a *App) apiSnapshots(w http.ResponseWriter, r *http.Request) {
+	repo, ok := a.apiRepo(w, r)
+	if !ok {
+		return
+	}
+	// Filter vor restic prüfen, ein ungültiges Datum kostet sonst einen ganzen Lauf
+	filter, err := parseSnapshotFilter(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_filter", err.Error())
+		return
+	}
+
+	snaps, err := ResticSnapshots(r.Context(), repo)
+	if recErr := a.store.RecordAccess(r.Context(), repo.ID, err); recErr != nil {
+		log.Printf("record access repo=%s err=%v", repo.ID, recErr)
+	}
+	if err != nil {
+		writeResticAPIError(w, err)
+		return
+	}
+	snaps = filter.Apply(snaps)
+	if snaps == nil {
+		snaps = []Snapshot{}
+	}
+	writeJSON(w, http.StatusOK, snaps)
+}
+
+func (a *App) apiList(w http.ResponseWriter, r *http.Request) {
+	repo, ok := a.apiRepo(w, r)
+	if !ok {
+		return
+	}
+	snap := r.PathValue("snap")
+	p := normalizeDirPath(r.URL.Query().Get("path"))
+
+	entries, err := a.listDir(r.Context(), repo, snap, p)
+	if err != nil {
+		writeResticAPIError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []LsEntry{}
+	}
+	writeJSON(w, http.StatusOK, apiListResponse{Snapshot: snap, Path: p, Entries: entries})
+}
+
+func (a *App) apiFiles(w http.ResponseWriter, r *http.Request) {
+	clean, abs, err := resolveFilesPath(r.URL.Query().Get("path"))
+	switch {
+	case errors.Is(err, errInvalidPath), errors.Is(err, errNotADir):
+		writeAPIError(w, http.StatusBadRequest, "invalid_path", err.Error())
+		return
+	case errors.Is(err, os.ErrNotExist):
+		writeAPIError(w, http.StatusNotFound, "path_not_found", "path not found")
+		return
+	case err != nil:
+		writeAPIError(w, http.StatusInternalServerError, "read_failed", err.Error())
+		return
+	}
+
+	entries, err := a.readFilesDir(r.Context(), clean, abs)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "read_failed", err.Error())
+		return
+	}
+
+	resp := apiFilesResponse{Path: clean, Entries: make([]apiFileEntry, 0, len(entries))}
+	if parent, ok := parentRelPath(clean); ok {
+		resp.Parent = &parent
+	}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, apiFileEntry{
+			Name:            e.Name,
+			Path:            e.RelPath,
+			IsDir:           e.IsDir,
+			Size:            e.Size,
+			ModTime:         e.ModTime,
+			IsRepo:          e.IsRepo,
+			RepoID:          e.RepoID,
+			RepoConfigured:  e.IsRepoConfigured,
+			LastCheckStatus: e.LastCheckStatus,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func toAPIJob(j Job) apiJob {
+	out := apiJob{
+		ID:           j.ID,
+		Kind:         j.Kind,
+		RepoID:       j.RepoID,
+		Status:       j.Status,
+		Params:       j.Params,
+		Progress:     j.Progress,
+		ProgressText: j.ProgressText,
+		Error:        j.Error,
+		CreatedAt:    j.CreatedAt,
+	}
+	if j.Status == JobDone && j.Artifact != "" {
+		out.ArtifactName = j.ArtifactName
+		out.ArtifactSize = j.ArtifactSize
+		out.ArtifactURL = "/jobs/" + j.ID + "/artifact"
+	}
+	if !j.StartedAt.IsZero() {
+		out.StartedAt = &j.StartedAt
+	}
+	if !j.FinishedAt.IsZero() {
+		out.FinishedAt = &j.FinishedAt
+	}
+	return out
+}
+
+func (a *App) apiJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := a.store.ListJobs(r.Context(), strings.ToUpper(r.URL.Query().Get("repo")), 200)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "config_error", err.Error())
+		return
+	}
+	out := make([]apiJob, 0, len(jobs))
+	for _, j := range jobs {
+		out = append(out, toAPIJob(j))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *App) apiJob(w http.ResponseWriter, r *http.Request) {
+	j, ok, err := a.store.GetJob(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "config_error", err.Error())
+		return
+	}
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "job_not_found", "job "+r.PathValue("id")+" does not exist")
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIJob(j))
+}
+
+func (a *App) apiStats(w http.ResponseWriter, r *http.Request) {
+	repo, ok := a.apiRepo(w, r)
+	if !ok {
+		return
+	}
+	snaps, err := ResticSnapshots(r.Context(), repo)
+	if err != nil {
+		writeResticAPIError(w, err)
+		return
+	}
+	st, err := a.repoStats(r.Context(), repo, snaps, r.URL.Query().Get("refresh") != "")
+	if err != nil {
+		writeResticAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveFormat beschreibt ein Download-Format für Ordner.
+type archiveFormat struct {
+	Name        string
+	Ext         string
+	ContentType string
+}
+
+var archiveFormats = map[string]archiveFormat{
+	"zip":     {Name: "zip", Ext: ".zip", ContentType: "application/zip"},
+	"tar":     {Name: "tar", Ext: ".tar", ContentType: "application/x-tar"},
+	"tar.gz":  {Name: "tar.gz", Ext: ".tar.gz", ContentType: "application/gzip"},
+	"tar.zst": {Name: "tar.zst", Ext: ".tar.zst", ContentType: "application/zstd"},
+}
+
+// archiveSink nimmt Einträge im tar-Format entgegen (so liefert sie restic) und
+// schreibt sie im Zielformat. hdr.Name ist bereits relativ, Ordner enden auf "/".
+type archiveSink interface {
+	Add(hdr *tar.Header, r io.Reader) error
+	Close() error
+}
+
+func newArchiveSink(format string, w io.Writer) (archiveSink, error) {
+	switch format {
+	case "zip":
+		return &zipSink{zw: zip.NewWriter(w)}, nil
+	case "tar":
+		return &tarSink{tw: tar.NewWriter(w)}, nil
+	case "tar.gz":
+		gz := gzip.NewWriter(w)
+		return &tarSink{tw: tar.NewWriter(gz), compressor: gz}, nil
+	case "tar.zst":
+		zs, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &tarSink{tw: tar.NewWriter(zs), compressor: zs}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+// tarSink übernimmt die restic Header unverändert: Modus, mtime, Besitzer,
+// Symlinks und leere Ordner bleiben erhalten.
+type tarSink struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+}
+
+func (s *tarSink) Add(hdr *tar.Header, r io.Reader) error {
+	if err := s.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeReg && r != nil {
+		if _, err := io.Copy(s.tw, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *tarSink) Close() error {
+	if err := s.tw.Close(); err != nil {
+		return err
+	}
+	if s.compressor != nil {
+		return s.compressor.Close()
+	}
+	return nil
+}
+
+// zipSink übernimmt mtime und Unix-Modus (external attributes), legt Ordner
+// (auch leere) als eigene Einträge an und speichert Symlinks als Link.
+type zipSink struct {
+	zw *zip.Writer
+}
+
+func (s *zipSink) Add(hdr *tar.Header, r io.Reader) error {
+	fh := &zip.FileHeader{
+		Name:     hdr.Name,
+		Method:   zip.Deflate,
+		Modified: hdr.ModTime,
+	}
+	fh.SetMode(hdr.FileInfo().Mode())
+
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+	case tar.TypeDir:
+		fh.Method = zip.Store
+		_, err := s.zw.CreateHeader(fh)
+		return err
+	case tar.TypeSymlink:
+		// Wie Info-ZIP: Inhalt des Eintrags ist das Linkziel
+		fh.Method = zip.Store
+		zf, err := s.zw.CreateHeader(fh)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(zf, hdr.Linkname)
+		return err
+	default:
+		// Geräte, FIFOs usw. lassen sich in ZIP nicht abbilden
+		return nil
+	}
+
+	zf, err := s.zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(zf, r)
+	return err
+}
+
+func (s *zipSink) Close() error { return s.zw.Close() }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// remoteBackend ist ein restic-Backend außerhalb des /repo-Mounts. Die
+// Zugangsdaten (Fields) landen in der verschlüsselten Umgebung des Repositories.
+type remoteBackend struct {
+	Scheme  string // Präfix ohne Doppelpunkt, z.B. "s3"
+	Label   string
+	Example string
+	Note    string
+	Fields  []backendField
+}
+
+type backendField struct {
+	Env   string
+	Label string
+}
+
+var remoteBackends = []remoteBackend{
+	{
+		Scheme: "s3", Label: "Amazon S3 / MinIO", Example: "s3:https://minio.example.com:9000/bucket/restic",
+		Fields: []backendField{
+			{"AWS_ACCESS_KEY_ID", "Access key ID"},
+			{"AWS_SECRET_ACCESS_KEY", "Secret access key"},
+			{"AWS_DEFAULT_REGION", "Region (optional)"},
+		},
+	},
+	{
+		Scheme: "b2", Label: "Backblaze B2", Example: "b2:bucket-name:path/to/repo",
+		Fields: []backendField{
+			{"B2_ACCOUNT_ID", "Account ID / key ID"},
+			{"B2_ACCOUNT_KEY", "Application key"},
+		},
+	},
+	{
+		Scheme: "azure", Label: "Azure Blob Storage", Example: "azure:container-name:/path/to/repo",
+		Fields: []backendField{
+			{"AZURE_ACCOUNT_NAME", "Account name"},
+			{"AZURE_ACCOUNT_KEY", "Account key"},
+		},
+	},
+	{
+		Scheme: "gs", Label: "Google Cloud Storage", Example: "gs:bucket-name:/path/to/repo",
+		Note: "The credentials file has to be mounted into the container.",
+		Fields: []backendField{
+			{"GOOGLE_PROJECT_ID", "Project ID"},
+			{"GOOGLE_APPLICATION_CREDENTIALS", "Path of the service account JSON file"},
+		},
+	},
+	{
+		Scheme: "rest", Label: "REST server", Example: "rest:https://backup.example.com:8000/repo",
+		Fields: []backendField{
+			{"RESTIC_REST_USERNAME", "Username (optional)"},
+			{"RESTIC_REST_PASSWORD", "Password (optional)"},
+		},
+	},
+	{
+		Scheme: "sftp", Label: "SFTP", Example: "sftp:user@host:/srv/restic-repo",
+		Note: "Uses the ssh client of the container: mount a key and known_hosts into /root/.ssh, password prompts are not supported.",
+	},
+	{
+		Scheme: "swift", Label: "OpenStack Swift", Example: "swift:container-name:/path/to/repo",
+		Fields: []backendField{
+			{"OS_AUTH_URL", "Auth URL"},
+			{"OS_USERNAME", "Username"},
+			{"OS_PASSWORD", "Password"},
+			{"OS_PROJECT_NAME", "Project name"},
+			{"OS_REGION_NAME", "Region (optional)"},
+		},
+	},
+	{
+		Scheme: "rclone", Label: "rclone", Example: "rclone:remote-name:path/to/repo",
+		Note: "Paste the rclone.conf section of the remote below. restic starts rclone itself; extra rclone settings can go into the environment as RCLONE_*.",
+	},
+}
+
+// remoteBackendFor liefert das Backend zu einem Repository-String wie
+// "s3:https://...". Lokale Pfade liefern false.
+func remoteBackendFor(repoPath string) (remoteBackend, bool) {
+	scheme, rest, ok := strings.Cut(repoPath, ":")
+	if !ok || rest == "" {
+		return remoteBackend{}, false
+	}
+	i := slices.IndexFunc(remoteBackends, func(b remoteBackend) bool { return b.Scheme == scheme })
+	if i < 0 {
+		return remoteBackend{}, false
+	}
+	return remoteBackends[i], true
+}
+
+func isRemoteRepo(repoPath string) bool {
+	_, ok := remoteBackendFor(repoPath)
+	return ok
+}
+
+func (b remoteBackend) hasField(env string) bool {
+	return slices.ContainsFunc(b.Fields, func(f backendField) bool { return f.Env == env })
+}
+
+// BackendForm ist ein Backend im Konfigurationsformular, Value ist wie im
+// Textfeld der Umgebung bei Secrets ***.
+type BackendForm struct {
+	remoteBackend
+	Active bool
+	Values map[string]string
+}
+
+func backendForms(repoPath string, env []string) []BackendForm {
+	current, _ := remoteBackendFor(repoPath)
+	out := make([]BackendForm, 0, len(remoteBackends))
+	for _, b := range remoteBackends {
+		f := BackendForm{remoteBackend: b, Active: b.Scheme == current.Scheme, Values: map[string]string{}}
+		if f.Active {
+			for _, fld := range b.Fields {
+				if v, ok := envLookup(env, fld.Env); ok {
+					if repoEnvSecret(fld.Env) {
+						v = redacted
+					}
+					f.Values[fld.Env] = v
+				}
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// withoutBackendFields entfernt die Variablen, die das Formular schon als
+// eigene Felder zeigt.
+func withoutBackendFields(env []string, repoPath string) []string {
+	b, ok := remoteBackendFor(repoPath)
+	if !ok {
+		return env
+	}
+	return slices.DeleteFunc(slices.Clone(env), func(kv string) bool {
+		name, _, _ := strings.Cut(kv, "=")
+		return b.hasField(name)
+	})
+}
+
+// mergeCredentials ergänzt env um die Felder cred_<NAME> des Formulars (value
+// liefert den Feldwert). *** übernimmt den Wert aus old, leere Felder fehlen.
+func (b remoteBackend) mergeCredentials(env, old []string, value func(name string) string) ([]string, error) {
+	out := slices.Clone(env)
+	for _, f := range b.Fields {
+		v := strings.TrimSpace(value(f.Env))
+		if v == "" {
+			continue
+		}
+		if _, dup := envLookup(out, f.Env); dup {
+			return nil, fmt.Errorf("Environment: %s is set twice", f.Env)
+		}
+		if v == redacted {
+			prev, ok := envLookup(old, f.Env)
+			if !ok {
+				return nil, fmt.Errorf("%s: no stored value to keep", f.Label)
+			}
+			v = prev
+		}
+		out = append(out, f.Env+"="+v)
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// keepStoredURLPassword: das Formular zeigt eine URL mit Passwort nur maskiert
+// (redactRepository). Kommt sie unverändert zurück, gilt die gespeicherte URL.
+func keepStoredURLPassword(form, stored string) string {
+	if stored != "" && repoURLHasPassword(stored) && form == redactRepository(stored) {
+		return stored
+	}
+	return form
+}
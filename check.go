@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Erlaubte Werte für --read-data-subset: "n/t", "x%" oder eine Größe wie "500M".
+// Eine Größe braucht die Einheit, eine nackte Zahl liest restic als Bytes.
+var readDataSubsetPattern = regexp.MustCompile(`^(\d+/\d+|\d+(\.\d+)?%|\d+[KMGT])$`)
+
+// handleCheck startet "restic check" als Hintergrund-Job.
+func (a *App) handleCheck(w http.ResponseWriter, r *http.Request) {
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	subset := strings.TrimSpace(r.FormValue("subset"))
+	if subset != "" && !readDataSubsetPattern.MatchString(subset) {
+		http.Error(w, "invalid read-data subset (e.g. 5%, 1/10 or 500M, sizes need a unit K/M/G/T)", 400)
+		return
+	}
+
+	j, err := a.jobs.Submit(r.Context(), "check", repo.ID, JobParams{ReadDataSubset: subset})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("submit job failed: %v", err), 500)
+		return
+	}
+	http.Redirect(w, r, "/jobs/"+j.ID, http.StatusSeeOther)
+}
+
+// runCheckJob führt "restic check" aus und speichert das Ergebnis am Repository.
+func (a *App) runCheckJob(ctx context.Context, jc *jobContext) error {
+	j := jc.Job()
+	repo, ok, err := a.store.GetRepo(ctx, j.RepoID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("repository %s is not configured", j.RepoID)
+	}
+
+	jc.Progress(0, "checking repository")
+	var last string
+	err = ResticCheck(ctx, repo, j.Params.ReadDataSubset, func(line string) {
+		last = line
+		jc.Logf("%s", line)
+	})
+	if ctx.Err() != nil {
+		// Abgebrochen: kein Ergebnis speichern
+		return ctx.Err()
+	}
+
+	status, msg := CheckOK, last
+	if err != nil {
+		status, msg = CheckError, err.Error()
+	}
+	if j.Params.ReadDataSubset != "" {
+		msg = "read data " + j.Params.ReadDataSubset + ": " + msg
+	}
+	if recErr := a.store.RecordCheck(context.Background(), repo.ID, status, msg); recErr != nil {
+		log.Printf("record check repo=%s err=%v", repo.ID, recErr)
+	}
+	return err
+}
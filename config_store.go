@@ -2,27 +2,56 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
 type RepoConfig struct {
-	ID        string
-	Path      string
-	Password  string
-	NoLock    bool
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID       string
+	Path     string
+	Password string
+	NoLock   bool
+	// Zusätzliche Umgebung für restic ("NAME=value", sortiert, siehe repo_env.go),
+	// verschlüsselt gespeichert, weil sie Zugangsdaten enthalten kann
+	Env []string
+	// rclone.conf für rclone:-Repositories (siehe rclone.go), verschlüsselt gespeichert
+	RcloneConfig string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+
+	// Status des letzten restic-Zugriffs (siehe RecordAccess)
+	LastAccessAt    time.Time
+	LastSuccessAt   time.Time
+	LastAccessError string
+
+	// Ergebnis des letzten "restic check" (siehe RecordCheck)
+	LastCheckAt      time.Time
+	LastCheckStatus  string // CheckOK, CheckError oder "" = nie geprüft
+	LastCheckMessage string
 }
 
+const (
+	CheckOK    = "ok"
+	CheckError = "error"
+)
+
 type ConfigStore struct {
-	db *sql.DB
+	db  *sql.DB
+	box *secretBox
 }
 
-func OpenConfigStore(dbPath string) (*ConfigStore, error) {
+func OpenConfigStore(dbPath, masterKey string) (*ConfigStore, error) {
+	if masterKey == "" {
+		return nil, errMasterKeyMissing
+	}
+
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return nil, err
@@ -31,7 +60,7 @@ func OpenConfigStore(dbPath string) (*ConfigStore, error) {
 	db.SetMaxOpenConns(1)
 
 	s := &ConfigStore{db: db}
-	if err := s.migrate(); err != nil {
+	if err := s.migrate(masterKey); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
@@ -40,7 +69,19 @@ func OpenConfigStore(dbPath string) (*ConfigStore, error) {
 
 func (s *ConfigStore) Close() error { return s.db.Close() }
 
-func (s *ConfigStore) migrate() error {
+// migrations werden in Reihenfolge ausgeführt; der Index+1 ist die Schema-Version
+// (PRAGMA user_version). Neue Schritte immer nur hinten anhängen.
+var migrations = []func(s *ConfigStore, tx *sql.Tx) error{
+	(*ConfigStore).migrateEncryptPasswords,
+	(*ConfigStore).migrateAccessStatus,
+	(*ConfigStore).migrateJobs,
+	(*ConfigStore).migrateCheckStatus,
+	(*ConfigStore).migrateRepoEnv,
+	(*ConfigStore).migrateRcloneConfig,
+	(*ConfigStore).migrateRepoURLSecret,
+}
+
+func (s *ConfigStore) migrate(masterKey string) error {
 	_, err := s.db.Exec(`
 CREATE TABLE IF NOT EXISTS repositories (
   id TEXT PRIMARY KEY,
@@ -51,19 +92,303 @@ CREATE TABLE IF NOT EXISTS repositories (
   updated_at TEXT NOT NULL
 );
 CREATE INDEX IF NOT EXISTS idx_repositories_path ON repositories(path);
+CREATE TABLE IF NOT EXISTS settings (
+  key TEXT PRIMARY KEY,
+  value TEXT NOT NULL
+);
+`)
+	if err != nil {
+		return err
+	}
+
+	if err := s.initSecretBox(masterKey); err != nil {
+		return err
+	}
+
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[i](s, tx); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initSecretBox leitet den Schlüssel aus dem Master Key ab und prüft ihn gegen den
+// gespeicherten Prüfwert. Beim ersten Start werden Salt und Prüfwert angelegt.
+func (s *ConfigStore) initSecretBox(masterKey string) error {
+	salt, ok, err := s.getSetting("kdf_salt")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		raw := make([]byte, 16)
+		if _, err := rand.Read(raw); err != nil {
+			return err
+		}
+		salt = base64.StdEncoding.EncodeToString(raw)
+		if err := s.setSetting("kdf_salt", salt); err != nil {
+			return err
+		}
+	}
+	rawSalt, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return fmt.Errorf("invalid kdf salt: %w", err)
+	}
+
+	box, err := newSecretBox(masterKey, rawSalt)
+	if err != nil {
+		return err
+	}
+
+	check, ok, err := s.getSetting("key_check")
+	if err != nil {
+		return err
+	}
+	if ok {
+		if plain, err := box.Open(check); err != nil || plain != keyCheckPlain {
+			return errWrongMasterKey
+		}
+	} else {
+		sealed, err := box.Seal(keyCheckPlain)
+		if err != nil {
+			return err
+		}
+		if err := s.setSetting("key_check", sealed); err != nil {
+			return err
+		}
+	}
+
+	s.box = box
+	return nil
+}
+
+// Version 1: bisher im Klartext gespeicherte Passwörter verschlüsseln.
+func (s *ConfigStore) migrateEncryptPasswords(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, password FROM repositories`)
+	if err != nil {
+		return err
+	}
+	plain := map[string]string{}
+	for rows.Next() {
+		var id, pw string
+		if err := rows.Scan(&id, &pw); err != nil {
+			rows.Close()
+			return err
+		}
+		plain[id] = pw
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, pw := range plain {
+		sealed, err := s.box.Seal(pw)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE repositories SET password = ? WHERE id = ?`, sealed, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Version 2: Status des letzten Zugriffs pro Repository.
+func (s *ConfigStore) migrateAccessStatus(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+ALTER TABLE repositories ADD COLUMN last_access_at TEXT;
+ALTER TABLE repositories ADD COLUMN last_success_at TEXT;
+ALTER TABLE repositories ADD COLUMN last_access_error TEXT NOT NULL DEFAULT '';
 `)
 	return err
 }
 
-func (s *ConfigStore) GetRepo(ctx context.Context, id string) (RepoConfig, bool, error) {
+// Version 3: Hintergrund-Jobs (siehe jobs.go).
+func (s *ConfigStore) migrateJobs(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+CREATE TABLE jobs (
+  id TEXT PRIMARY KEY,
+  kind TEXT NOT NULL,
+  repo_id TEXT NOT NULL,
+  status TEXT NOT NULL,
+  params TEXT NOT NULL,
+  progress REAL NOT NULL DEFAULT 0,
+  progress_text TEXT NOT NULL DEFAULT '',
+  log TEXT NOT NULL DEFAULT '',
+  error TEXT NOT NULL DEFAULT '',
+  artifact TEXT NOT NULL DEFAULT '',
+  artifact_name TEXT NOT NULL DEFAULT '',
+  artifact_size INTEGER NOT NULL DEFAULT 0,
+  created_at TEXT NOT NULL,
+  started_at TEXT,
+  finished_at TEXT
+);
+CREATE INDEX idx_jobs_status ON jobs(status);
+`)
+	return err
+}
+
+// Version 4: Ergebnis des letzten "restic check" pro Repository.
+func (s *ConfigStore) migrateCheckStatus(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+ALTER TABLE repositories ADD COLUMN last_check_at TEXT;
+ALTER TABLE repositories ADD COLUMN last_check_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE repositories ADD COLUMN last_check_message TEXT NOT NULL DEFAULT '';
+`)
+	return err
+}
+
+// Version 5: Umgebung pro Repository (verschlüsseltes JSON, "" = keine).
+func (s *ConfigStore) migrateRepoEnv(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE repositories ADD COLUMN env TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// Version 6: rclone.conf pro Repository (verschlüsselt, "" = keine).
+func (s *ConfigStore) migrateRcloneConfig(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE repositories ADD COLUMN rclone_config TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// Version 7: Repository-URLs mit Passwort verschlüsselt in path_secret, in path
+// steht nur noch die geschwärzte URL (Anzeige, Index).
+func (s *ConfigStore) migrateRepoURLSecret(tx *sql.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE repositories ADD COLUMN path_secret TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, path FROM repositories`)
+	if err != nil {
+		return err
+	}
+	paths := map[string]string{}
+	for rows.Next() {
+		var id, p string
+		if err := rows.Scan(&id, &p); err != nil {
+			rows.Close()
+			return err
+		}
+		if repoURLHasPassword(p) {
+			paths[id] = p
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, p := range paths {
+		sealed, err := s.box.Seal(p)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE repositories SET path = ?, path_secret = ? WHERE id = ?`,
+			redactRepository(p), sealed, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ConfigStore) getSetting(key string) (string, bool, error) {
+	var v string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+func (s *ConfigStore) setSetting(key, value string) error {
+	_, err := s.db.Exec(`
+INSERT INTO settings (key, value) VALUES (?, ?)
+ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, value)
+	return err
+}
+
+const repoColumns = `id, path, password, no_lock, created_at, updated_at,
+  last_access_at, last_success_at, last_access_error,
+  last_check_at, last_check_status, last_check_message, env, rclone_config, path_secret`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (s *ConfigStore) scanRepo(row rowScanner) (RepoConfig, error) {
 	var r RepoConfig
 	var noLock int
 	var created, updated string
+	var lastAccess, lastSuccess, lastCheck sql.NullString
+	var env, rcloneConf, pathSecret string
+
+	if err := row.Scan(&r.ID, &r.Path, &r.Password, &noLock, &created, &updated,
+		&lastAccess, &lastSuccess, &r.LastAccessError,
+		&lastCheck, &r.LastCheckStatus, &r.LastCheckMessage, &env, &rcloneConf, &pathSecret); err != nil {
+		return RepoConfig{}, err
+	}
 
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, path, password, no_lock, created_at, updated_at FROM repositories WHERE id = ?`,
+	pw, err := s.box.Open(r.Password)
+	if err != nil {
+		return RepoConfig{}, fmt.Errorf("repository %s: %w", r.ID, err)
+	}
+	r.Password = pw
+
+	if pathSecret != "" {
+		if r.Path, err = s.box.Open(pathSecret); err != nil {
+			return RepoConfig{}, fmt.Errorf("repository %s path: %w", r.ID, err)
+		}
+	}
+
+	if env != "" {
+		plain, err := s.box.Open(env)
+		if err != nil {
+			return RepoConfig{}, fmt.Errorf("repository %s env: %w", r.ID, err)
+		}
+		if err := json.Unmarshal([]byte(plain), &r.Env); err != nil {
+			return RepoConfig{}, fmt.Errorf("repository %s env: %w", r.ID, err)
+		}
+	}
+	if rcloneConf != "" {
+		if r.RcloneConfig, err = s.box.Open(rcloneConf); err != nil {
+			return RepoConfig{}, fmt.Errorf("repository %s rclone config: %w", r.ID, err)
+		}
+	}
+
+	r.NoLock = noLock != 0
+	r.CreatedAt, _ = time.Parse(time.RFC3339, created)
+	r.UpdatedAt, _ = time.Parse(time.RFC3339, updated)
+	r.LastAccessAt, _ = time.Parse(time.RFC3339, lastAccess.String)
+	r.LastSuccessAt, _ = time.Parse(time.RFC3339, lastSuccess.String)
+	r.LastCheckAt, _ = time.Parse(time.RFC3339, lastCheck.String)
+	return r, nil
+}
+
+func (s *ConfigStore) GetRepo(ctx context.Context, id string) (RepoConfig, bool, error) {
+	r, err := s.scanRepo(s.db.QueryRowContext(ctx,
+		`SELECT `+repoColumns+` FROM repositories WHERE id = ?`,
 		id,
-	).Scan(&r.ID, &r.Path, &r.Password, &noLock, &created, &updated)
+	))
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return RepoConfig{}, false, nil
@@ -71,10 +396,6 @@ func (s *ConfigStore) GetRepo(ctx context.Context, id string) (RepoConfig, bool,
 	if err != nil {
 		return RepoConfig{}, false, err
 	}
-
-	r.NoLock = noLock != 0
-	r.CreatedAt, _ = time.Parse(time.RFC3339, created)
-	r.UpdatedAt, _ = time.Parse(time.RFC3339, updated)
 	return r, true, nil
 }
 
@@ -85,22 +406,55 @@ func (s *ConfigStore) Upsert(ctx context.Context, r RepoConfig) error {
 		noLock = 1
 	}
 
-	_, err := s.db.ExecContext(ctx, `
-INSERT INTO repositories (id, path, password, no_lock, created_at, updated_at)
-VALUES (?, ?, ?, ?, ?, ?)
+	password, err := s.box.Seal(r.Password)
+	if err != nil {
+		return err
+	}
+
+	env := ""
+	if len(r.Env) > 0 {
+		b, err := json.Marshal(r.Env)
+		if err != nil {
+			return err
+		}
+		if env, err = s.box.Seal(string(b)); err != nil {
+			return err
+		}
+	}
+	// Passwort in der URL: nur verschlüsselt speichern, path bleibt lesbar
+	path, pathSecret := r.Path, ""
+	if repoURLHasPassword(r.Path) {
+		path = redactRepository(r.Path)
+		if pathSecret, err = s.box.Seal(r.Path); err != nil {
+			return err
+		}
+	}
+	rcloneConf := ""
+	if r.RcloneConfig != "" {
+		if rcloneConf, err = s.box.Seal(r.RcloneConfig); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+INSERT INTO repositories (id, path, path_secret, password, no_lock, env, rclone_config, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 ON CONFLICT(id) DO UPDATE SET
   path = excluded.path,
+  path_secret = excluded.path_secret,
   password = excluded.password,
   no_lock = excluded.no_lock,
+  env = excluded.env,
+  rclone_config = excluded.rclone_config,
   updated_at = excluded.updated_at
-`, r.ID, r.Path, r.Password, noLock, now, now)
+`, r.ID, path, pathSecret, password, noLock, env, rcloneConf, now, now)
 
 	return err
 }
 
 func (s *ConfigStore) List(ctx context.Context) ([]RepoConfig, error) {
 	rows, err := s.db.QueryContext(ctx, `
-SELECT id, path, password, no_lock, created_at, updated_at
+SELECT `+repoColumns+`
 FROM repositories
 ORDER BY id ASC`)
 	if err != nil {
@@ -110,16 +464,47 @@ ORDER BY id ASC`)
 
 	var out []RepoConfig
 	for rows.Next() {
-		var r RepoConfig
-		var noLock int
-		var created, updated string
-		if err := rows.Scan(&r.ID, &r.Path, &r.Password, &noLock, &created, &updated); err != nil {
+		r, err := s.scanRepo(rows)
+		if err != nil {
 			return nil, err
 		}
-		r.NoLock = noLock != 0
-		r.CreatedAt, _ = time.Parse(time.RFC3339, created)
-		r.UpdatedAt, _ = time.Parse(time.RFC3339, updated)
 		out = append(out, r)
 	}
 	return out, rows.Err()
 }
+
+func (s *ConfigStore) Delete(ctx context.Context, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM repositories WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RecordAccess merkt sich das Ergebnis des letzten restic-Zugriffs auf ein Repository.
+func (s *ConfigStore) RecordAccess(ctx context.Context, id string, accessErr error) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if accessErr != nil {
+		_, err := s.db.ExecContext(ctx, `
+UPDATE repositories SET last_access_at = ?, last_access_error = ? WHERE id = ?`,
+			now, accessErr.Error(), id)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `
+UPDATE repositories SET last_access_at = ?, last_success_at = ?, last_access_error = '' WHERE id = ?`,
+		now, now, id)
+	return err
+}
+
+// RecordCheck speichert das Ergebnis eines "restic check".
+func (s *ConfigStore) RecordCheck(ctx context.Context, id, status, msg string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.db.ExecContext(ctx, `
+UPDATE repositories SET last_check_at = ?, last_check_status = ?, last_check_message = ? WHERE id = ?`,
+		now, status, msg, id)
+	return err
+}
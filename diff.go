@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type DiffEntry struct {
+	Path  string
+	Name  string
+	Kind  string // "added", "removed", "modified", "metadata"
+	IsDir bool
+	SizeA int64
+	SizeB int64
+	Delta int64
+}
+
+// DiffGroup fasst alle Änderungen eines Ordners zusammen (einklappbar im Template).
+type DiffGroup struct {
+	Dir     string
+	Entries []DiffEntry
+	Delta   int64
+}
+
+type DiffPageModel struct {
+	Title      string
+	RepoConfig RepoConfig
+	Snapshots  []Snapshot
+	A, B       string
+	Groups     []DiffGroup
+	Stats      DiffStats
+	Added      int
+	Removed    int
+	Modified   int
+	Delta      int64
+	Error      string
+}
+
+func (a *App) handleDiff(w http.ResponseWriter, r *http.Request) {
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		a.handleRedirectToConfig(w, r, repoID)
+		return
+	}
+
+	snaps, err := ResticSnapshots(r.Context(), repo)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("restic snapshots failed: %v", err), 500)
+		return
+	}
+
+	model := DiffPageModel{
+		Title:      "Diff",
+		RepoConfig: repo,
+		Snapshots:  snaps,
+		A:          r.URL.Query().Get("a"),
+		B:          r.URL.Query().Get("b"),
+	}
+
+	// Nur B angegeben: mit dem nächst älteren Snapshot vergleichen
+	if model.A == "" && model.B != "" {
+		for i, s := range snaps {
+			if s.ID == model.B && i+1 < len(snaps) {
+				model.A = snaps[i+1].ID
+			}
+		}
+	}
+
+	if model.A != "" && model.B != "" {
+		if err := a.buildDiff(r.Context(), repo, &model); err != nil {
+			model.Error = fmt.Sprintf("restic diff failed: %v", err)
+		}
+	}
+
+	if err := a.diffTpl.ExecuteTemplate(w, "diff.html", model); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+func (a *App) buildDiff(ctx context.Context, repo RepoConfig, model *DiffPageModel) error {
+	changes, stats, err := ResticDiff(ctx, repo, model.A, model.B)
+	if err != nil {
+		return err
+	}
+	model.Stats = stats
+
+	// restic diff liefert keine Größen, daher beide Bäume einmal komplett listen
+	sizesA, err := a.snapshotSizes(ctx, repo, model.A)
+	if err != nil {
+		return err
+	}
+	sizesB, err := a.snapshotSizes(ctx, repo, model.B)
+	if err != nil {
+		return err
+	}
+
+	groups := map[string]*DiffGroup{}
+	for _, c := range changes {
+		isDir := strings.HasSuffix(c.Path, "/")
+		p := strings.TrimSuffix(c.Path, "/")
+
+		e := DiffEntry{
+			Path:  p,
+			Name:  p[strings.LastIndex(p, "/")+1:],
+			IsDir: isDir,
+			SizeA: sizesA[p],
+			SizeB: sizesB[p],
+		}
+		switch {
+		case strings.Contains(c.Modifier, "+"):
+			e.Kind = "added"
+			e.SizeA = 0
+			model.Added++
+		case strings.Contains(c.Modifier, "-"):
+			e.Kind = "removed"
+			e.SizeB = 0
+			model.Removed++
+		case strings.ContainsAny(c.Modifier, "MT?"):
+			e.Kind = "modified"
+			model.Modified++
+		default:
+			e.Kind = "metadata"
+		}
+		if !isDir {
+			e.Delta = e.SizeB - e.SizeA
+		}
+
+		dir := parentPath(p)
+		g, ok := groups[dir]
+		if !ok {
+			g = &DiffGroup{Dir: dir}
+			groups[dir] = g
+		}
+		g.Entries = append(g.Entries, e)
+		g.Delta += e.Delta
+		model.Delta += e.Delta
+	}
+
+	model.Groups = make([]DiffGroup, 0, len(groups))
+	for _, g := range groups {
+		model.Groups = append(model.Groups, *g)
+	}
+	sort.Slice(model.Groups, func(i, j int) bool {
+		return model.Groups[i].Dir < model.Groups[j].Dir
+	})
+	return nil
+}
+
+func (a *App) snapshotSizes(ctx context.Context, repo RepoConfig, snap string) (map[string]int64, error) {
+	entries, err := a.listRecursive(ctx, repo, snap)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(entries))
+	for _, e := range entries {
+		if e.Type != "dir" {
+			out[e.Path] = e.Size
+		}
+	}
+	return out, nil
+}
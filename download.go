@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// handleDownload liefert eine einzelne Datei mit Content-Length, ETag und
+// Range-Unterstützung, damit abgebrochene Downloads fortgesetzt werden können.
+func (a *App) handleDownload(w http.ResponseWriter, r *http.Request) {
+	snap := r.URL.Query().Get("snap")
+	p := r.URL.Query().Get("path")
+	if snap == "" || p == "" {
+		http.Error(w, "missing snap or path", 400)
+		return
+	}
+
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	entry, found, err := a.lookupEntry(r.Context(), repo, snap, p)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	if entry.Type != "file" {
+		http.Error(w, "not a file", 400)
+		return
+	}
+
+	// Force attachment filename (best-effort)
+	filename := path.Base(strings.TrimSuffix(entry.Path, "/"))
+	if filename == "" || filename == "/" || filename == "." {
+		filename = "download.bin"
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	// Content-Type explizit setzen, sonst liest ServeContent zum Sniffen an
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	// Nur eine vollständige Snapshot-ID garantiert unveränderten Inhalt. Bei
+	// "latest" o.ä. gibt es daher weder ETag noch Teil-Downloads.
+	if fullSnapshotID.MatchString(snap) {
+		w.Header().Set("ETag", downloadETag(snap, entry.Path))
+	} else {
+		r.Header.Del("Range")
+		r.Header.Del("If-Range")
+	}
+
+	var modTime time.Time
+	if mt, err := time.Parse(time.RFC3339Nano, entry.Mtime); err == nil {
+		modTime = mt
+	}
+
+	content := &dumpReader{ctx: r.Context(), repo: repo, snap: snap, path: entry.Path, size: entry.Size}
+	defer content.Close()
+	http.ServeContent(w, r, filename, modTime, content)
+	if content.err != nil {
+		// Header sind schon raus, nur loggen
+		log.Printf("download failed snap=%s path=%s err=%v", snap, p, content.err)
+	}
+}
+
+// downloadETag ist ein starker ETag: Inhalt unter Snapshot-ID + Pfad ändert sich nie.
+func downloadETag(snap, p string) string {
+	sum := sha256.Sum256([]byte(snap + "\x00" + p))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// dumpReader ist ein io.ReadSeeker über "restic dump". restic kann nicht ab
+// einem Offset lesen, deshalb startet ein Seek den Prozess neu und verwirft die
+// Bytes bis zur gewünschten Position. Gestartet wird erst beim ersten Read, HEAD
+// und 304 kosten also keinen restic-Aufruf.
+type dumpReader struct {
+	ctx  context.Context
+	repo RepoConfig
+	snap string
+	path string
+	size int64
+
+	off    int64 // gewünschte Leseposition
+	pos    int64 // Position des laufenden Streams
+	pr     *io.PipeReader
+	cancel context.CancelFunc
+	err    error // erster restic-Fehler, fürs Logging
+}
+
+func (d *dumpReader) Read(p []byte) (int, error) {
+	if d.off >= d.size {
+		return 0, io.EOF
+	}
+	if d.pr == nil || d.pos != d.off {
+		if err := d.start(); err != nil {
+			return 0, d.fail(err)
+		}
+	}
+	n, err := d.pr.Read(p)
+	d.off += int64(n)
+	d.pos = d.off
+	if err != nil && err != io.EOF {
+		err = d.fail(err)
+	}
+	return n, err
+}
+
+func (d *dumpReader) start() error {
+	d.stop()
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(ResticDumpToWriter(ctx, d.repo, d.snap, d.path, pw))
+	}()
+	d.pr, d.cancel = pr, cancel
+
+	if d.off > 0 {
+		if _, err := io.CopyN(io.Discard, pr, d.off); err != nil {
+			return err
+		}
+	}
+	d.pos = d.off
+	return nil
+}
+
+func (d *dumpReader) fail(err error) error {
+	if d.err == nil {
+		d.err = err
+	}
+	return err
+}
+
+func (d *dumpReader) stop() {
+	if d.cancel != nil {
+		d.cancel()
+		d.pr.Close()
+		d.pr, d.cancel = nil, nil
+	}
+}
+
+func (d *dumpReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.off
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("dumpReader: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("dumpReader: negative position")
+	}
+	d.off = offset
+	return offset, nil
+}
+
+func (d *dumpReader) Close() error {
+	d.stop()
+	return nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -20,6 +22,8 @@ type FileEntry struct {
 	IsRepo           bool // directory is restic repo root
 	IsRepoConfigured bool
 	RepoID           string // e.g. "SRV002"
+	LastCheckAt      time.Time
+	LastCheckStatus  string // siehe RepoConfig.LastCheckStatus
 }
 
 type FilesPageModel struct {
@@ -33,32 +37,26 @@ type FilesPageModel struct {
 	Error      string
 }
 
-func (a *App) handleFiles(w http.ResponseWriter, r *http.Request) {
-	const base = "/repo"
-
-	rel := strings.TrimSpace(r.URL.Query().Get("path")) // e.g. "docs" or "docs/srv002"
-	rel = strings.TrimPrefix(rel, "/")
+var (
+	errInvalidPath = errors.New("invalid path")
+	errNotADir     = errors.New("path is not a directory")
+)
 
-	// Normalize + prevent traversal
-	clean := path.Clean("/" + rel) // safe clean in URL path style
-	if strings.Contains(clean, "..") {
+func (a *App) handleFiles(w http.ResponseWriter, r *http.Request) {
+	clean, abs, err := resolveFilesPath(r.URL.Query().Get("path"))
+	if errors.Is(err, errInvalidPath) {
 		http.Error(w, "invalid path", http.StatusBadRequest)
 		return
 	}
-	clean = strings.TrimPrefix(clean, "/") // back to relative
-
-	abs := filepath.Join(base, filepath.FromSlash(clean))
-
-	fi, err := os.Stat(abs)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("path not found: %v", err), http.StatusNotFound)
-		return
-	}
-	if !fi.IsDir() {
+	if errors.Is(err, errNotADir) {
 		// Optional: handle plain file download later. For now: 400
 		http.Error(w, "path is not a directory", http.StatusBadRequest)
 		return
 	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("path not found: %v", err), http.StatusNotFound)
+		return
+	}
 
 	// If this directory is a restic repo AND configured -> redirect to /repositories/{repo}
 	if isResticRepoRoot(abs) {
@@ -78,12 +76,63 @@ func (a *App) handleFiles(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	dirEntries, err := os.ReadDir(abs)
+	entries, err := a.readFilesDir(r.Context(), clean, abs)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("read dir failed: %v", err), 500)
 		return
 	}
 
+	parentRel, showParent := parentRelPath(clean)
+
+	model := FilesPageModel{
+		Title:      "Files",
+		RelPath:    clean,
+		ParentRel:  parentRel,
+		ShowParent: showParent,
+		Entries:    entries,
+		RepoBase:   "/repositories",
+		FilesBase:  "/files",
+	}
+
+	if err := a.filesTpl.ExecuteTemplate(w, "files.html", model); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+// resolveFilesPath macht aus dem "path" Query-Parameter einen sauberen relativen
+// Pfad unter /repo und den zugehörigen absoluten Pfad.
+func resolveFilesPath(rel string) (string, string, error) {
+	const base = "/repo"
+
+	rel = strings.TrimSpace(rel) // e.g. "docs" or "docs/srv002"
+	rel = strings.TrimPrefix(rel, "/")
+
+	// Normalize + prevent traversal
+	clean := path.Clean("/" + rel) // safe clean in URL path style
+	if strings.Contains(clean, "..") {
+		return "", "", errInvalidPath
+	}
+	clean = strings.TrimPrefix(clean, "/") // back to relative
+
+	abs := filepath.Join(base, filepath.FromSlash(clean))
+
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return "", "", err
+	}
+	if !fi.IsDir() {
+		return "", "", errNotADir
+	}
+	return clean, abs, nil
+}
+
+// readFilesDir liest ein Verzeichnis unter /repo und markiert restic Repositories.
+func (a *App) readFilesDir(ctx context.Context, clean, abs string) ([]FileEntry, error) {
+	dirEntries, err := os.ReadDir(abs)
+	if err != nil {
+		return nil, err
+	}
+
 	entries := make([]FileEntry, 0, len(dirEntries))
 	for _, de := range dirEntries {
 		name := de.Name()
@@ -113,8 +162,10 @@ func (a *App) handleFiles(w http.ResponseWriter, r *http.Request) {
 			fe.IsRepo = true
 			fe.RepoID = a.detectRepoIdFromUrlPath(childAbs)
 
-			if _, configured, err := a.store.GetRepo(r.Context(), fe.RepoID); err == nil {
+			if repo, configured, err := a.store.GetRepo(ctx, fe.RepoID); err == nil {
 				fe.IsRepoConfigured = configured
+				fe.LastCheckAt = repo.LastCheckAt
+				fe.LastCheckStatus = repo.LastCheckStatus
 			} else {
 				fe.IsRepoConfigured = false
 			}
@@ -131,21 +182,7 @@ func (a *App) handleFiles(w http.ResponseWriter, r *http.Request) {
 		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
 	})
 
-	parentRel, showParent := parentRelPath(clean)
-
-	model := FilesPageModel{
-		Title:      "Files",
-		RelPath:    clean,
-		ParentRel:  parentRel,
-		ShowParent: showParent,
-		Entries:    entries,
-		RepoBase:   "/repositories",
-		FilesBase:  "/files",
-	}
-
-	if err := a.filesTpl.ExecuteTemplate(w, "files.html", model); err != nil {
-		http.Error(w, err.Error(), 500)
-	}
+	return entries, nil
 }
 
 func joinRel(rel, name string) string {
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// FindRow ist eine Zeile der Zeitleiste: ein Snapshot und seine Treffer.
+type FindRow struct {
+	Snapshot Snapshot
+	Matches  []FindMatch
+}
+
+type FindPageModel struct {
+	Title      string
+	RepoConfig RepoConfig
+	Pattern    string
+	IgnoreCase bool
+	Filter     SnapshotFilter
+	Hosts      []string
+	Tags       []string
+	Searched   bool
+	Rows       []FindRow
+	Found      int // Anzahl Snapshots mit Treffern
+	LastSeen   *FindRow
+	FirstSeen  *FindRow
+	Error      string
+}
+
+// handleFind sucht ein Dateimuster in allen (gefilterten) Snapshots eines Repositories
+// und zeigt pro Snapshot, ob und wie die Datei dort existiert.
+func (a *App) handleFind(w http.ResponseWriter, r *http.Request) {
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		a.handleRedirectToConfig(w, r, repoID)
+		return
+	}
+
+	snaps, err := ResticSnapshots(r.Context(), repo)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("restic snapshots failed: %v", err), 500)
+		return
+	}
+
+	model := FindPageModel{
+		Title:      "Find",
+		RepoConfig: repo,
+		Pattern:    strings.TrimSpace(r.URL.Query().Get("q")),
+		IgnoreCase: r.URL.Query().Get("icase") == "on",
+		Hosts:      snapshotHosts(snaps),
+		Tags:       snapshotTags(snaps),
+	}
+
+	filter, err := parseSnapshotFilter(r.URL.Query())
+	model.Filter = filter
+	if err != nil {
+		model.Error = err.Error()
+	}
+
+	if model.Pattern != "" && model.Error == "" {
+		model.Searched = true
+		if err := findAcrossSnapshots(r.Context(), repo, filter, filter.Apply(snaps), &model); err != nil {
+			log.Printf("find failed repo=%s pattern=%q err=%v", repoID, model.Pattern, err)
+			model.Error = fmt.Sprintf("restic find failed: %v", err)
+		}
+	}
+
+	if err := a.findTpl.ExecuteTemplate(w, "find.html", model); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+func findAcrossSnapshots(ctx context.Context, repo RepoConfig, filter SnapshotFilter, snaps []Snapshot, model *FindPageModel) error {
+	if len(snaps) == 0 {
+		return nil
+	}
+
+	// Host, Tag und Pfad filtert restic selbst; eine Liste von --snapshot IDs
+	// würde bei tausenden Snapshots ARG_MAX sprengen. Treffer aus Snapshots
+	// außerhalb des Zeitraums fallen unten weg, weil nur snaps eine Zeile bekommen.
+	results, err := ResticFind(ctx, repo, model.Pattern, model.IgnoreCase, filter)
+	if err != nil {
+		return err
+	}
+
+	bySnap := make(map[string][]FindMatch, len(results))
+	for _, res := range results {
+		bySnap[res.Snapshot] = res.Matches
+	}
+
+	// snaps ist neueste zuerst sortiert (ResticSnapshots)
+	model.Rows = make([]FindRow, 0, len(snaps))
+	for _, s := range snaps {
+		row := FindRow{Snapshot: s, Matches: bySnap[s.ID]}
+		model.Rows = append(model.Rows, row)
+	}
+	for i := range model.Rows {
+		if len(model.Rows[i].Matches) == 0 {
+			continue
+		}
+		model.Found++
+		if model.LastSeen == nil {
+			model.LastSeen = &model.Rows[i]
+		}
+		model.FirstSeen = &model.Rows[i]
+	}
+	return nil
+}
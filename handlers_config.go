@@ -1,19 +1,32 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// Zeitlimit für die Prüfung der Zugangsdaten beim Speichern
+const configCheckTimeout = 30 * time.Second
+
 type ConfigPageModel struct {
-	Title  string
-	ID     string
-	Path   string
-	NoLock bool
-	Error  string
+	Title    string
+	ID       string
+	Path     string
+	NoLock   bool
+	Env      string // Textarea, eine Variable pro Zeile, Secrets als ***
+	Remote   bool   // Backend-URL statt Pfad unter /repo
+	Backends []BackendForm
+	// rclone.conf wird nie angezeigt, nur ob eine gespeichert ist
+	RcloneConfig       string
+	RcloneConfigStored bool
+	Error              string
 }
 
 func (a *App) handleConfigGet(w http.ResponseWriter, r *http.Request) {
@@ -31,21 +44,35 @@ func (a *App) handleConfigGet(w http.ResponseWriter, r *http.Request) {
 		ID:     id,
 		Path:   p,
 		NoLock: true,
+		Remote: r.URL.Query().Get("remote") == "1",
 	}
 
 	// Falls schon vorhanden -> vorfüllen (außer Passwort)
+	var env []string
 	if id != "" {
 		if repo, ok, err := a.store.GetRepo(r.Context(), id); err == nil && ok {
-			model.Path = repo.Path
+			// Passwörter in Backend-URLs nur maskiert anzeigen
+			model.Path = redactRepository(repo.Path)
 			model.NoLock = repo.NoLock
+			model.RcloneConfigStored = repo.RcloneConfig != ""
+			env = repo.Env
 		}
 	}
+	model.Remote = model.Remote || isRemoteRepo(model.Path)
+	model.Env = formatRepoEnv(withoutBackendFields(env, model.Path))
+	model.Backends = backendForms(model.Path, env)
+	if model.Remote && id == "" {
+		model.Title = "Add Remote Repository"
+	}
 
 	_ = a.configTpl.ExecuteTemplate(w, "config.html", model)
 }
 
 func (a *App) ensureRepoPrefix(p string) string {
 	p = strings.TrimSpace(p)
+	if isRemoteRepo(p) {
+		return p
+	}
 	if p != "" && !strings.HasPrefix(p, "/") {
 		p = "/repo/" + strings.TrimPrefix(strings.TrimPrefix(p, "/repo"), "/")
 	}
@@ -66,39 +93,101 @@ func (a *App) handleConfigPost(w http.ResponseWriter, r *http.Request) {
 
 	// Validierung (minimal, Step 4 härten wir)
 	if id == "" || p == "" || pw == "" {
-		model := ConfigPageModel{
-			Title:  "Configure Repository",
-			ID:     id,
-			Path:   p,
-			NoLock: noLock,
-			Error:  "Please fill ID, Path and Password.",
+		a.renderConfigError(w, r, "Please fill ID, Path and Password.")
+		return
+	}
+	// restic entfernt Leerzeichen am Rand von --password-file (siehe resticCmd),
+	// ein solches Passwort würde nie passen
+	if pw != strings.TrimSpace(pw) {
+		a.renderConfigError(w, r, "The password starts or ends with whitespace. restic strips it when reading the password, "+
+			"so it would not match: change the repository password with \"restic key passwd\" first.")
+		return
+	}
+
+	// *** bzw. ein maskiertes URL-Passwort im Formular übernimmt den gespeicherten Wert
+	existing, _, err := a.store.GetRepo(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	p = keepStoredURLPassword(p, existing.Path)
+	backend, remote := remoteBackendFor(p)
+
+	clean := p
+	switch {
+	case remote:
+		// Backend-URLs gehen unverändert an restic
+	case r.FormValue("remote") == "1":
+		a.renderConfigError(w, r, "Unknown backend: the repository has to start with "+remoteSchemes()+".")
+		return
+	default:
+		// Security: Path muss unter /repo liegen
+		base := "/repo"
+		clean = filepath.Clean(p)
+		if clean != base && !strings.HasPrefix(clean, base+string(os.PathSeparator)) {
+			a.renderConfigError(w, r, "Path must be inside /repo.")
+			return
 		}
-		_ = a.configTpl.ExecuteTemplate(w, "config.html", model)
+	}
+
+	env, err := parseRepoEnv(r.FormValue("env"), existing.Env)
+	if err != nil {
+		a.renderConfigError(w, r, "Environment: "+err.Error())
+		return
+	}
+	// Zugangsdaten des Backends aus den eigenen Feldern
+	env, err = backend.mergeCredentials(env, existing.Env, func(name string) string {
+		return r.FormValue("cred_" + name)
+	})
+	if err != nil {
+		a.renderConfigError(w, r, err.Error())
 		return
 	}
 
-	// Security: Path muss unter /repo liegen
-	base := "/repo"
-	clean := filepath.Clean(p)
-	if clean != base && !strings.HasPrefix(clean, base+string(os.PathSeparator)) {
-		model := ConfigPageModel{
-			Title:  "Configure Repository",
-			ID:     id,
-			Path:   p,
-			NoLock: noLock,
-			Error:  "Path must be inside /repo.",
+	// rclone.conf: leer lässt die gespeicherte Datei unverändert
+	var rcloneConf string
+	if isRcloneRepo(clean) {
+		rcloneConf = r.FormValue("rclone_config")
+		if strings.TrimSpace(rcloneConf) == "" && r.FormValue("rclone_config_clear") != "on" {
+			rcloneConf = existing.RcloneConfig
 		}
-		_ = a.configTpl.ExecuteTemplate(w, "config.html", model)
+		if err := validateRcloneConfig(rcloneConf, clean); err != nil {
+			a.renderConfigError(w, r, err.Error())
+			return
+		}
+	}
+
+	repo := RepoConfig{
+		ID:           id,
+		Path:         clean,
+		Password:     pw,
+		NoLock:       noLock,
+		Env:          env,
+		RcloneConfig: rcloneConf,
+	}
+
+	// Zugangsdaten prüfen, bevor wir eine kaputte Konfiguration speichern
+	ctx, cancel := context.WithTimeout(r.Context(), configCheckTimeout)
+	defer cancel()
+	if err := ResticCatConfig(ctx, repo); err != nil {
+		// exec beendet restic beim Timeout mit "signal: killed", der
+		// Context-Fehler steckt nicht in err
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = ctx.Err()
+		}
+		a.renderConfigError(w, r, configCheckMessage(err))
 		return
 	}
 
 	// Speichern
-	if err := a.store.Upsert(r.Context(), RepoConfig{
-		ID:       id,
-		Path:     clean,
-		Password: pw,
-		NoLock:   noLock,
-	}); err != nil {
+	if err := a.store.Upsert(r.Context(), repo); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	// anderer Pfad oder andere Zugangsdaten: Statistik und Dateiversionen neu ermitteln
+	a.stats.Purge(id)
+	a.history.Purge(id)
+	if err := a.store.RecordAccess(r.Context(), id, nil); err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
@@ -106,6 +195,59 @@ func (a *App) handleConfigPost(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/repositories/"+strings.ToLower(id), http.StatusFound)
 }
 
+// renderConfigError zeigt das Formular mit den eingegebenen Werten erneut an
+// (ohne Passwort).
+func (a *App) renderConfigError(w http.ResponseWriter, r *http.Request, msg string) {
+	p := a.ensureRepoPrefix(r.FormValue("path"))
+	model := ConfigPageModel{
+		Title:    "Configure Repository",
+		ID:       strings.ToUpper(strings.TrimSpace(r.FormValue("id"))),
+		Path:     p,
+		NoLock:   r.FormValue("no_lock") == "on",
+		Env:      r.FormValue("env"),
+		Remote:   r.FormValue("remote") == "1" || isRemoteRepo(p),
+		Backends: backendForms(p, nil),
+		Error:    msg,
+
+		RcloneConfig: r.FormValue("rclone_config"),
+	}
+	if id := strings.ToUpper(strings.TrimSpace(r.FormValue("id"))); id != "" {
+		if repo, ok, err := a.store.GetRepo(r.Context(), id); err == nil && ok {
+			model.RcloneConfigStored = repo.RcloneConfig != ""
+		}
+	}
+	for _, b := range model.Backends {
+		for _, f := range b.Fields {
+			if v := r.FormValue("cred_" + f.Env); v != "" {
+				b.Values[f.Env] = v
+			}
+		}
+	}
+	_ = a.configTpl.ExecuteTemplate(w, "config.html", model)
+}
+
+func remoteSchemes() string {
+	s := make([]string, len(remoteBackends))
+	for i, b := range remoteBackends {
+		s[i] = b.Scheme + ":"
+	}
+	return strings.Join(s, ", ")
+}
+
+func configCheckMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrWrongPassword):
+		return "Wrong password: restic could not open this repository with the given password."
+	case errors.Is(err, ErrNotARepository):
+		return "Not a repository: there is no restic repository at this path."
+	case errors.Is(err, ErrResticNotFound):
+		return "restic not found: the restic binary is not installed or not in PATH on the server."
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Timeout: restic did not answer within " + configCheckTimeout.String() + "."
+	}
+	return "Repository check failed: " + err.Error()
+}
+
 func qs(values map[string]string) string {
 	v := url.Values{}
 	for k, val := range values {
@@ -115,3 +257,71 @@ func qs(values map[string]string) string {
 	}
 	return v.Encode()
 }
+
+type ConfigsPageModel struct {
+	Title string
+	Repos []RepoConfig
+}
+
+func (a *App) handleConfigsList(w http.ResponseWriter, r *http.Request) {
+	repos, err := a.store.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	model := ConfigsPageModel{
+		Title: "Repositories",
+		Repos: repos,
+	}
+	if err := a.configsTpl.ExecuteTemplate(w, "configs.html", model); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+func (a *App) handleConfigDelete(w http.ResponseWriter, r *http.Request) {
+	id := strings.ToUpper(r.PathValue("repo"))
+
+	ok, err := a.store.Delete(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	a.trees.Purge(id)
+	a.stats.Purge(id)
+	a.history.Purge(id)
+	// Jobs würden sonst weiterlaufen und mit "not configured" scheitern
+	if err := a.jobs.CancelRepo(r.Context(), id); err != nil {
+		log.Printf("cancel jobs of %s failed: %v", id, err)
+	}
+
+	http.Redirect(w, r, "/configs", http.StatusSeeOther)
+}
+
+// handleConfigTest prüft mit "restic cat config", ob das Repository erreichbar ist,
+// und speichert das Ergebnis als Zugriffsstatus.
+func (a *App) handleConfigTest(w http.ResponseWriter, r *http.Request) {
+	id := strings.ToUpper(r.PathValue("repo"))
+
+	repo, ok, err := a.store.GetRepo(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	testErr := ResticCatConfig(r.Context(), repo)
+	if err := a.store.RecordAccess(r.Context(), id, testErr); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	http.Redirect(w, r, "/configs", http.StatusSeeOther)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Parallele restic-Prozesse beim Auflösen der Versionen
+const historyWorkers = 4
+
+// Obergrenze für gecachte Einträge; danach wird der Cache verworfen
+const historyCacheMax = 50_000
+
+// FileVersion beschreibt eine Datei in einem bestimmten Snapshot.
+type FileVersion struct {
+	Present bool
+	Type    string
+	Size    int64
+	Mtime   time.Time
+	Hash    string // Hash über die Content-Blob-IDs, gleich = gleicher Inhalt
+}
+
+type HistoryRow struct {
+	Snapshot Snapshot
+	FileVersion
+	Changed bool // Inhalt unterscheidet sich von der nächst älteren Version
+}
+
+type HistoryPageModel struct {
+	Title      string
+	RepoConfig RepoConfig
+	Path       string
+	Dir        string
+	Rows       []HistoryRow
+	Versions   int // Anzahl unterschiedlicher Inhalte
+	Error      string
+}
+
+// historyCache merkt sich aufgelöste Dateiversionen. Snapshots sind unveränderlich,
+// daher ist ein Eintrag für repo+snapshot+pfad gültig, solange das Repository
+// unter seiner ID gleich bleibt (siehe Purge).
+type historyCache struct {
+	mu sync.Mutex
+	m  map[historyKey]FileVersion
+}
+
+type historyKey struct {
+	repoID, snap, path string
+}
+
+func newHistoryCache() *historyCache {
+	return &historyCache{m: map[historyKey]FileVersion{}}
+}
+
+func (c *historyCache) get(key historyKey) (FileVersion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.m[key]
+	return v, ok
+}
+
+func (c *historyCache) put(key historyKey, v FileVersion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.m) >= historyCacheMax {
+		c.m = map[historyKey]FileVersion{}
+	}
+	c.m[key] = v
+}
+
+// Purge vergisst alle Versionen eines Repositories (geändert oder gelöscht):
+// unter derselben ID kann danach ein anderes Repository liegen.
+func (c *historyCache) Purge(repoID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.m {
+		if k.repoID == repoID {
+			delete(c.m, k)
+		}
+	}
+}
+
+func (a *App) handleHistory(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" || p == "/" {
+		http.Error(w, "missing path", 400)
+		return
+	}
+	p = "/" + strings.Trim(p, "/")
+
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	snaps, err := ResticSnapshots(r.Context(), repo)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("restic snapshots failed: %v", err), 500)
+		return
+	}
+
+	model := HistoryPageModel{
+		Title:      "History",
+		RepoConfig: repo,
+		Path:       p,
+		Dir:        parentPath(p),
+	}
+
+	versions, err := a.resolveFileVersions(r.Context(), repo, snaps, p)
+	if err != nil {
+		model.Error = fmt.Sprintf("resolving file versions failed: %v", err)
+	}
+
+	// snaps ist neueste zuerst sortiert; Änderungen gegen die nächst ältere Version markieren
+	model.Rows = make([]HistoryRow, len(snaps))
+	for i, s := range snaps {
+		model.Rows[i] = HistoryRow{Snapshot: s, FileVersion: versions[i]}
+	}
+	lastHash := ""
+	for i := len(model.Rows) - 1; i >= 0; i-- {
+		row := &model.Rows[i]
+		if !row.Present {
+			continue
+		}
+		if row.Hash != lastHash {
+			row.Changed = true
+			model.Versions++
+		}
+		lastHash = row.Hash
+	}
+
+	if err := a.historyTpl.ExecuteTemplate(w, "history.html", model); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+// resolveFileVersions löst p in allen Snapshots parallel auf (Ergebnis in gleicher
+// Reihenfolge wie snaps).
+func (a *App) resolveFileVersions(ctx context.Context, repo RepoConfig, snaps []Snapshot, p string) ([]FileVersion, error) {
+	out := make([]FileVersion, len(snaps))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	jobs := make(chan int)
+
+	for range historyWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				v, err := a.fileVersion(ctx, repo, snaps[i].ID, p)
+				if err != nil {
+					errOnce.Do(func() { firstErr = err; cancel() })
+					continue
+				}
+				out[i] = v
+			}
+		}()
+	}
+
+	for i := range snaps {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return out, firstErr
+}
+
+func (a *App) fileVersion(ctx context.Context, repo RepoConfig, snapID, p string) (FileVersion, error) {
+	key := historyKey{repo.ID, snapID, p}
+	if v, ok := a.history.get(key); ok {
+		return v, nil
+	}
+
+	// Baum des Snapshots schon im Cache: fehlende Datei ohne restic-Aufruf erkennen
+	if tree, ok := a.trees.Cached(repo.ID, snapID); ok {
+		if _, found := tree.Lookup(p); !found {
+			a.history.put(key, FileVersion{})
+			return FileVersion{}, nil
+		}
+	}
+
+	nodes, err := ResticCatTree(ctx, repo, snapID, path.Dir(p))
+	if err != nil {
+		// Fehlt der Ordner in diesem Snapshot, fehlt auch die Datei. Das sagt das
+		// Listing des Ordners, nicht der (sprachabhängige) Fehlertext von restic.
+		exists, lerr := dirInSnapshot(ctx, repo, snapID, path.Dir(p))
+		if lerr != nil || exists {
+			return FileVersion{}, err
+		}
+		a.history.put(key, FileVersion{})
+		return FileVersion{}, nil
+	}
+
+	var v FileVersion
+	name := path.Base(p)
+	for _, n := range nodes {
+		if n.Name != name {
+			continue
+		}
+		v = FileVersion{
+			Present: true,
+			Type:    n.Type,
+			Size:    n.Size,
+			Mtime:   n.Mtime,
+			Hash:    contentHash(n.Content),
+		}
+		break
+	}
+
+	a.history.put(key, v)
+	return v, nil
+}
+
+// dirInSnapshot prüft mit "restic ls snap dir", ob dir im Snapshot existiert;
+// für einen fehlenden Pfad gibt ls nichts aus.
+func dirInSnapshot(ctx context.Context, repo RepoConfig, snapID, dir string) (bool, error) {
+	if dir == "/" {
+		return true, nil
+	}
+	entries, err := ResticList(ctx, repo, snapID, dir)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range entries {
+		if e.Path == dir && e.Type == "dir" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func contentHash(blobs []string) string {
+	h := sha256.New()
+	for _, b := range blobs {
+		h.Write([]byte(b))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hintergrund-Jobs: lange restic-Aufrufe (Restore, Archive, ...) laufen
+// unabhängig vom HTTP-Request. Status, Fortschritt und Log stehen in der SQLite
+// DB, fertige Dateien (Artifacts) im Ordner "jobs" neben der DB.
+
+const (
+	defaultJobWorkers   = 2
+	defaultJobRetention = 7 * 24 * time.Hour
+	jobProgressInterval = time.Second
+)
+
+// jobFunc führt einen Job aus. ctx wird beim Abbrechen beendet.
+type jobFunc func(ctx context.Context, jc *jobContext) error
+
+type JobManager struct {
+	store     *ConfigStore
+	dir       string
+	workers   int
+	retention time.Duration
+	runners   map[string]jobFunc
+	queue     chan string
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+// jobManagerFromEnv liest JOB_WORKERS und JOB_RETENTION (Go-Duration, z.B.
+// "72h"). Artifacts liegen in "<db-ordner>/jobs".
+func jobManagerFromEnv(store *ConfigStore, dbPath string, runners map[string]jobFunc) (*JobManager, error) {
+	workers := defaultJobWorkers
+	if v := os.Getenv("JOB_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			workers = n
+		} else {
+			log.Printf("WARN: invalid JOB_WORKERS=%q, using %d", v, workers)
+		}
+	}
+	retention := defaultJobRetention
+	if v := os.Getenv("JOB_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			retention = d
+		} else {
+			log.Printf("WARN: invalid JOB_RETENTION=%q, using %s", v, retention)
+		}
+	}
+
+	dir := filepath.Join(filepath.Dir(dbPath), "jobs")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("job dir %s: %w", dir, err)
+	}
+
+	return &JobManager{
+		store:     store,
+		dir:       dir,
+		workers:   workers,
+		retention: retention,
+		runners:   runners,
+		queue:     make(chan string, 1024),
+		running:   map[string]context.CancelFunc{},
+	}, nil
+}
+
+// Start markiert beim letzten Beenden unterbrochene Jobs, stellt wartende Jobs
+// wieder in die Queue und startet die Worker. Das Aufräumen endet mit ctx.
+func (m *JobManager) Start(ctx context.Context) error {
+	n, err := m.store.InterruptRunningJobs(ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("jobs: %d job(s) interrupted by restart", n)
+	}
+
+	ids, err := m.store.QueuedJobIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < m.workers; i++ {
+		go m.worker()
+	}
+	go func() {
+		for _, id := range ids {
+			m.queue <- id
+		}
+	}()
+	go m.cleanupLoop(ctx)
+	return nil
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Submit legt einen Job an und reiht ihn ein.
+func (m *JobManager) Submit(ctx context.Context, kind, repoID string, params JobParams) (Job, error) {
+	if _, ok := m.runners[kind]; !ok {
+		return Job{}, fmt.Errorf("unknown job kind %q", kind)
+	}
+	j := Job{
+		ID:        newJobID(),
+		Kind:      kind,
+		RepoID:    repoID,
+		Status:    JobQueued,
+		Params:    params,
+		CreatedAt: time.Now(),
+	}
+	if err := m.store.InsertJob(ctx, j); err != nil {
+		return Job{}, err
+	}
+	go func() { m.queue <- j.ID }()
+	return j, nil
+}
+
+// Cancel bricht einen wartenden oder laufenden Job ab. Ein Job, den ein Worker
+// gerade übernimmt, ist schon in running eingetragen; sein Context ist dann
+// abgebrochen, bevor der Runner startet.
+func (m *JobManager) Cancel(ctx context.Context, id string) error {
+	m.mu.Lock()
+	cancel, ok := m.running[id]
+	m.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	_, err := m.store.CancelQueuedJob(ctx, id)
+	return err
+}
+
+// CancelRepo bricht alle wartenden und laufenden Jobs eines Repositories ab,
+// z.B. wenn es gelöscht wird.
+func (m *JobManager) CancelRepo(ctx context.Context, repoID string) error {
+	ids, err := m.store.ActiveJobIDs(ctx, repoID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := m.Cancel(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ArtifactPath ist der Pfad der Ergebnisdatei eines Jobs.
+func (m *JobManager) ArtifactPath(j Job) string {
+	return filepath.Join(m.dir, filepath.Base(j.Artifact))
+}
+
+// Delete entfernt einen abgeschlossenen Job samt Artifact.
+func (m *JobManager) Delete(ctx context.Context, j Job) error {
+	if j.Active() {
+		return errors.New("job is still active")
+	}
+	if j.Artifact != "" {
+		if err := os.Remove(m.ArtifactPath(j)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	_, err := m.store.DeleteJob(ctx, j.ID)
+	return err
+}
+
+func (m *JobManager) worker() {
+	for id := range m.queue {
+		m.run(id)
+	}
+}
+
+func (m *JobManager) run(id string) {
+	bg := context.Background()
+
+	// cancel vor dem Claim eintragen, sonst ginge ein Cancel zwischen Claim
+	// und Start verloren (der Job wäre nicht mehr queued, aber noch nicht in running)
+	ctx, cancel := context.WithCancel(bg)
+	m.mu.Lock()
+	m.running[id] = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, id)
+		m.mu.Unlock()
+		cancel()
+	}()
+
+	claimed, err := m.store.ClaimJob(bg, id)
+	if err != nil {
+		log.Printf("jobs: claim %s failed: %v", id, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	if ctx.Err() != nil {
+		if err := m.store.FinishJob(bg, id, JobCanceled, "canceled"); err != nil {
+			log.Printf("jobs: finish %s failed: %v", id, err)
+		}
+		return
+	}
+	j, ok, err := m.store.GetJob(bg, id)
+	if err != nil || !ok {
+		log.Printf("jobs: load %s failed: %v", id, err)
+		return
+	}
+
+	jc := &jobContext{m: m, job: j}
+	log.Printf("jobs: start %s kind=%s repo=%s", j.ID, j.Kind, j.RepoID)
+	runErr := m.runners[j.Kind](ctx, jc)
+	jc.flush()
+
+	status, msg := JobDone, ""
+	switch {
+	case runErr == nil:
+		if err := m.store.UpdateJobProgress(bg, id, 1, jc.text); err != nil {
+			log.Printf("jobs: update %s failed: %v", id, err)
+		}
+	case ctx.Err() != nil:
+		status, msg = JobCanceled, "canceled"
+	default:
+		status, msg = JobFailed, runErr.Error()
+	}
+	if status != JobDone && jc.artifact != "" {
+		_ = os.Remove(filepath.Join(m.dir, jc.artifact))
+		_ = m.store.SetJobArtifact(bg, id, "", "", 0)
+	}
+	if err := m.store.FinishJob(bg, id, status, msg); err != nil {
+		log.Printf("jobs: finish %s failed: %v", id, err)
+	}
+	log.Printf("jobs: %s %s err=%v", j.ID, status, runErr)
+}
+
+// cleanupLoop löscht abgeschlossene Jobs (und ihre Artifacts) nach JOB_RETENTION.
+func (m *JobManager) cleanupLoop(ctx context.Context) {
+	for {
+		jobs, err := m.store.FinishedJobsBefore(ctx, time.Now().Add(-m.retention))
+		if err != nil {
+			log.Printf("jobs: cleanup failed: %v", err)
+		}
+		for _, j := range jobs {
+			if err := m.Delete(ctx, j); err != nil {
+				log.Printf("jobs: cleanup %s failed: %v", j.ID, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
+
+// jobContext ist die Sicht eines laufenden Jobs auf den Manager.
+type jobContext struct {
+	m   *JobManager
+	job Job
+
+	mu        sync.Mutex
+	progress  float64
+	text      string
+	lastFlush time.Time
+	artifact  string
+}
+
+func (jc *jobContext) Job() Job { return jc.job }
+
+// Progress merkt sich den Fortschritt (0..1) und schreibt ihn höchstens einmal
+// pro Sekunde in die DB; restic meldet im JSON-Modus sehr viel häufiger.
+func (jc *jobContext) Progress(frac float64, text string) {
+	jc.mu.Lock()
+	jc.progress, jc.text = frac, text
+	due := time.Since(jc.lastFlush) >= jobProgressInterval
+	jc.mu.Unlock()
+	if due {
+		jc.flush()
+	}
+}
+
+func (jc *jobContext) flush() {
+	jc.mu.Lock()
+	frac, text := jc.progress, jc.text
+	jc.lastFlush = time.Now()
+	jc.mu.Unlock()
+	if err := jc.m.store.UpdateJobProgress(context.Background(), jc.job.ID, frac, text); err != nil {
+		log.Printf("jobs: progress %s failed: %v", jc.job.ID, err)
+	}
+}
+
+func (jc *jobContext) Logf(format string, args ...any) {
+	line := time.Now().Format("15:04:05") + " " + fmt.Sprintf(format, args...)
+	if err := jc.m.store.AppendJobLog(context.Background(), jc.job.ID, line); err != nil {
+		log.Printf("jobs: log %s failed: %v", jc.job.ID, err)
+	}
+}
+
+// CreateArtifact legt die Ergebnisdatei an; name ist der spätere Download-Name.
+// Schlägt der Job fehl, wird die Datei wieder gelöscht.
+func (jc *jobContext) CreateArtifact(name string) (*os.File, error) {
+	file := jc.job.ID + "-" + filepath.Base(name)
+	f, err := os.OpenFile(filepath.Join(jc.m.dir, file), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	jc.artifact = file
+	if err := jc.m.store.SetJobArtifact(context.Background(), jc.job.ID, file, name, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// FinishArtifact speichert die endgültige Größe der Ergebnisdatei.
+func (jc *jobContext) FinishArtifact(name string, size int64) error {
+	return jc.m.store.SetJobArtifact(context.Background(), jc.job.ID, jc.artifact, name, size)
+}
+
+// -------------------- Seiten --------------------
+
+type JobsPageModel struct {
+	Title  string
+	Jobs   []Job
+	Active bool
+}
+
+type JobPageModel struct {
+	Title string
+	Job   Job
+}
+
+// jobDescription beschreibt einen Job in einer Zeile für die Listen.
+func jobDescription(j Job) string {
+	p := j.Params
+	switch j.Kind {
+	case "restore":
+		return fmt.Sprintf("Restore %s from %s to %s", p.Path, shortID(p.Snap), p.Target)
+	case "archive":
+		return fmt.Sprintf("%s of %d path(s) from %s", strings.ToUpper(p.Format), len(p.Paths), shortID(p.Snap))
+	case "check":
+		if p.ReadDataSubset != "" {
+			return "Check repository (read data " + p.ReadDataSubset + ")"
+		}
+		return "Check repository"
+	}
+	return j.Kind
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func (a *App) handleJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := a.store.ListJobs(r.Context(), strings.ToUpper(r.URL.Query().Get("repo")), 200)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error loading jobs: %v", err), 500)
+		return
+	}
+	m := JobsPageModel{Title: "Jobs", Jobs: jobs}
+	for _, j := range jobs {
+		m.Active = m.Active || j.Active()
+	}
+	if err := a.jobsTpl.ExecuteTemplate(w, "jobs.html", m); err != nil {
+		http.Error(w, fmt.Sprintf("template error: %v", err), 500)
+	}
+}
+
+func (a *App) loadJob(w http.ResponseWriter, r *http.Request) (Job, bool) {
+	j, ok, err := a.store.GetJob(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error loading job: %v", err), 500)
+		return Job{}, false
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return Job{}, false
+	}
+	return j, true
+}
+
+func (a *App) handleJob(w http.ResponseWriter, r *http.Request) {
+	j, ok := a.loadJob(w, r)
+	if !ok {
+		return
+	}
+	if err := a.jobTpl.ExecuteTemplate(w, "job.html", JobPageModel{Title: "Job", Job: j}); err != nil {
+		http.Error(w, fmt.Sprintf("template error: %v", err), 500)
+	}
+}
+
+func (a *App) handleJobCancel(w http.ResponseWriter, r *http.Request) {
+	j, ok := a.loadJob(w, r)
+	if !ok {
+		return
+	}
+	if err := a.jobs.Cancel(r.Context(), j.ID); err != nil {
+		http.Error(w, fmt.Sprintf("cancel failed: %v", err), 500)
+		return
+	}
+	http.Redirect(w, r, "/jobs/"+j.ID, http.StatusSeeOther)
+}
+
+func (a *App) handleJobDelete(w http.ResponseWriter, r *http.Request) {
+	j, ok := a.loadJob(w, r)
+	if !ok {
+		return
+	}
+	if err := a.jobs.Delete(r.Context(), j); err != nil {
+		http.Error(w, fmt.Sprintf("delete failed: %v", err), 409)
+		return
+	}
+	http.Redirect(w, r, "/jobs", http.StatusSeeOther)
+}
+
+func (a *App) handleJobArtifact(w http.ResponseWriter, r *http.Request) {
+	j, ok := a.loadJob(w, r)
+	if !ok {
+		return
+	}
+	if j.Status != JobDone || j.Artifact == "" {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(a.jobs.ArtifactPath(j))
+	if err != nil {
+		http.Error(w, "artifact not available", 410)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	contentType := "application/octet-stream"
+	for _, af := range archiveFormats {
+		if strings.HasSuffix(j.ArtifactName, af.Ext) {
+			contentType = af.ContentType
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, j.ArtifactName))
+	http.ServeContent(w, r, j.ArtifactName, fi.ModTime(), f)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Job-Status
+const (
+	JobQueued      = "queued"
+	JobRunning     = "running"
+	JobDone        = "done"
+	JobFailed      = "failed"
+	JobCanceled    = "canceled"
+	JobInterrupted = "interrupted" // lief noch, als der Prozess beendet wurde
+)
+
+// Log eines Jobs wird auf diese Länge (Zeichen vom Ende) gekürzt
+const maxJobLog = 64 * 1024
+
+// JobParams sind die Eingaben eines Jobs; welche Felder genutzt werden, hängt
+// von Kind ab. Keine Geheimnisse hier ablegen, sie stehen im Klartext in der DB.
+type JobParams struct {
+	Snap      string   `json:"snap,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	Format    string   `json:"format,omitempty"`
+	Target    string   `json:"target,omitempty"`
+	Overwrite string   `json:"overwrite,omitempty"`
+	// restic check --read-data-subset
+	ReadDataSubset string `json:"read_data_subset,omitempty"`
+}
+
+type Job struct {
+	ID           string
+	Kind         string
+	RepoID       string
+	Status       string
+	Params       JobParams
+	Progress     float64 // 0..1
+	ProgressText string
+	Log          string
+	Error        string
+	Artifact     string // Dateiname im Job-Ordner, "" = keins
+	ArtifactName string // Dateiname für den Download
+	ArtifactSize int64
+	CreatedAt    time.Time
+	StartedAt    time.Time
+	FinishedAt   time.Time
+}
+
+func (j Job) Active() bool { return j.Status == JobQueued || j.Status == JobRunning }
+
+func (j Job) Percent() int { return int(j.Progress * 100) }
+
+// StatusClass ist die Bootstrap-Farbe für den Status-Badge.
+func (j Job) StatusClass() string {
+	switch j.Status {
+	case JobDone:
+		return "success"
+	case JobFailed, JobInterrupted:
+		return "danger"
+	case JobRunning:
+		return "primary"
+	}
+	return "secondary"
+}
+
+const jobColumns = `id, kind, repo_id, status, params, progress, progress_text, log, error,
+  artifact, artifact_name, artifact_size, created_at, started_at, finished_at`
+
+func scanJob(row rowScanner) (Job, error) {
+	var j Job
+	var params, created string
+	var started, finished sql.NullString
+
+	if err := row.Scan(&j.ID, &j.Kind, &j.RepoID, &j.Status, &params, &j.Progress, &j.ProgressText,
+		&j.Log, &j.Error, &j.Artifact, &j.ArtifactName, &j.ArtifactSize, &created, &started, &finished); err != nil {
+		return Job{}, err
+	}
+	if err := json.Unmarshal([]byte(params), &j.Params); err != nil {
+		return Job{}, err
+	}
+	j.CreatedAt, _ = time.Parse(time.RFC3339, created)
+	j.StartedAt, _ = time.Parse(time.RFC3339, started.String)
+	j.FinishedAt, _ = time.Parse(time.RFC3339, finished.String)
+	return j, nil
+}
+
+func (s *ConfigStore) InsertJob(ctx context.Context, j Job) error {
+	params, err := json.Marshal(j.Params)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+INSERT INTO jobs (id, kind, repo_id, status, params, created_at)
+VALUES (?, ?, ?, ?, ?, ?)`,
+		j.ID, j.Kind, j.RepoID, j.Status, string(params), j.CreatedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (s *ConfigStore) GetJob(ctx context.Context, id string) (Job, bool, error) {
+	j, err := scanJob(s.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+	return j, true, nil
+}
+
+// ListJobs liefert die neuesten Jobs zuerst; repoID "" = alle Repositories.
+func (s *ConfigStore) ListJobs(ctx context.Context, repoID string, limit int) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT `+jobColumns+`
+FROM jobs
+WHERE ? = '' OR repo_id = ?
+ORDER BY created_at DESC, rowid DESC
+LIMIT ?`, repoID, repoID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+// ClaimJob setzt einen wartenden Job auf "running". false, wenn er inzwischen
+// abgebrochen wurde oder schon läuft.
+func (s *ConfigStore) ClaimJob(ctx context.Context, id string) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.ExecContext(ctx, `
+UPDATE jobs SET status = ?, started_at = ? WHERE id = ? AND status = ?`,
+		JobRunning, now, id, JobQueued)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *ConfigStore) UpdateJobProgress(ctx context.Context, id string, progress float64, text string) error {
+	_, err := s.db.ExecContext(ctx, `
+UPDATE jobs SET progress = ?, progress_text = ? WHERE id = ?`, progress, text, id)
+	return err
+}
+
+func (s *ConfigStore) AppendJobLog(ctx context.Context, id, line string) error {
+	_, err := s.db.ExecContext(ctx, `
+UPDATE jobs SET log = substr(log || ?, -?) WHERE id = ?`, line+"\n", maxJobLog, id)
+	return err
+}
+
+func (s *ConfigStore) SetJobArtifact(ctx context.Context, id, file, name string, size int64) error {
+	_, err := s.db.ExecContext(ctx, `
+UPDATE jobs SET artifact = ?, artifact_name = ?, artifact_size = ? WHERE id = ?`, file, name, size, id)
+	return err
+}
+
+func (s *ConfigStore) FinishJob(ctx context.Context, id, status, errMsg string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.db.ExecContext(ctx, `
+UPDATE jobs SET status = ?, error = ?, finished_at = ? WHERE id = ?`, status, errMsg, now, id)
+	return err
+}
+
+// CancelQueuedJob bricht einen Job ab, der noch nicht gestartet wurde.
+func (s *ConfigStore) CancelQueuedJob(ctx context.Context, id string) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.ExecContext(ctx, `
+UPDATE jobs SET status = ?, finished_at = ? WHERE id = ? AND status = ?`,
+		JobCanceled, now, id, JobQueued)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// InterruptRunningJobs markiert Jobs, die beim letzten Beenden noch liefen.
+func (s *ConfigStore) InterruptRunningJobs(ctx context.Context) (int64, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.ExecContext(ctx, `
+UPDATE jobs SET status = ?, error = 'interrupted by restart', finished_at = ? WHERE status = ?`,
+		JobInterrupted, now, JobRunning)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *ConfigStore) QueuedJobIDs(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id FROM jobs WHERE status = ? ORDER BY created_at ASC, rowid ASC`, JobQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ActiveJobIDs liefert die wartenden und laufenden Jobs eines Repositories.
+func (s *ConfigStore) ActiveJobIDs(ctx context.Context, repoID string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id FROM jobs WHERE repo_id = ? AND status IN (?, ?)`, repoID, JobQueued, JobRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// FinishedJobsBefore liefert abgeschlossene Jobs, die vor t beendet wurden.
+func (s *ConfigStore) FinishedJobsBefore(ctx context.Context, t time.Time) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT `+jobColumns+`
+FROM jobs
+WHERE status NOT IN (?, ?) AND finished_at < ?`,
+		JobQueued, JobRunning, t.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+func (s *ConfigStore) DeleteJob(ctx context.Context, id string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM jobs WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -17,21 +21,37 @@ import (
 var templateFS embed.FS
 
 type App struct {
-	indexTpl  *template.Template
-	browseTpl *template.Template
-	filesTpl  *template.Template
-	configTpl *template.Template
-
-	store *ConfigStore
+	indexTpl   *template.Template
+	browseTpl  *template.Template
+	filesTpl   *template.Template
+	configTpl  *template.Template
+	configsTpl *template.Template
+	searchTpl  *template.Template
+	findTpl    *template.Template
+	diffTpl    *template.Template
+	historyTpl *template.Template
+	previewTpl *template.Template
+	restoreTpl *template.Template
+	jobsTpl    *template.Template
+	jobTpl     *template.Template
+	statsTpl   *template.Template
+
+	store   *ConfigStore
+	history *historyCache
+	trees   *treeCache
+	stats   *statsCache
+
+	jobs           *JobManager
+	restoreTargets []string
 }
 
 func main() {
-	// Basic env sanity (minimal)
-	if os.Getenv("RESTIC_REPOSITORY") == "" {
-		log.Println("WARN: RESTIC_REPOSITORY not set (container should set it, or your shell).")
-	}
-	if os.Getenv("RESTIC_PASSWORD_FILE") == "" && os.Getenv("RESTIC_PASSWORD") == "" {
-		log.Println("WARN: Neither RESTIC_PASSWORD_FILE nor RESTIC_PASSWORD set. restic will likely fail.")
+	// restic bekommt nur die Umgebung aus der Repository-Konfiguration (repo_env.go),
+	// globale Repository-Variablen wirken nicht mehr
+	for _, name := range []string{"RESTIC_REPOSITORY", "RESTIC_REPOSITORY_FILE", "RESTIC_PASSWORD", "RESTIC_PASSWORD_FILE", "RESTIC_PASSWORD_COMMAND"} {
+		if os.Getenv(name) != "" {
+			log.Printf("WARN: %s is set but ignored, repositories and passwords are configured under /configs", name)
+		}
 	}
 
 	dbPath := os.Getenv("CONFIG_DB_PATH")
@@ -39,14 +59,23 @@ func main() {
 		dbPath = "/data/config.db"
 	}
 
-	store, err := OpenConfigStore(dbPath)
+	masterKey, err := loadMasterKey()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	store, err := OpenConfigStore(dbPath, masterKey)
+	if err != nil {
+		log.Fatalf("open config store: %v", err)
+	}
+
 	funcs := template.FuncMap{
 		"basename": path.Base,
 		"lower":    strings.ToLower,
+		"datetime": formatDateTime,
+		"bytes":    formatBytes,
+		"jobdesc":  jobDescription,
+		"repourl":  redactRepository,
 	}
 
 	indexTpl := template.Must(template.New("").
@@ -61,8 +90,75 @@ func main() {
 	configTpl := template.Must(template.New("").
 		Funcs(funcs).
 		ParseFS(templateFS, "templates/layout.html", "templates/config.html"))
+	configsTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/configs.html"))
+	searchTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/search.html"))
+	findTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/find.html"))
+	diffTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/diff.html"))
+	historyTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/history.html"))
+	previewTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/preview.html"))
+	restoreTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/restore.html"))
+	jobsTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/jobs.html"))
+	statsTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/stats.html"))
+	jobTpl := template.Must(template.New("").
+		Funcs(funcs).
+		ParseFS(templateFS, "templates/layout.html", "templates/job.html"))
+
+	app := &App{
+		indexTpl:       indexTpl,
+		browseTpl:      browseTpl,
+		filesTpl:       filesTpl,
+		configTpl:      configTpl,
+		configsTpl:     configsTpl,
+		searchTpl:      searchTpl,
+		findTpl:        findTpl,
+		diffTpl:        diffTpl,
+		historyTpl:     historyTpl,
+		previewTpl:     previewTpl,
+		restoreTpl:     restoreTpl,
+		jobsTpl:        jobsTpl,
+		jobTpl:         jobTpl,
+		statsTpl:       statsTpl,
+		store:          store,
+		history:        newHistoryCache(),
+		trees:          treeCacheFromEnv(dbPath),
+		stats:          newStatsCache(),
+		restoreTargets: restoreTargetsFromEnv(),
+	}
+
+	jobs, err := jobManagerFromEnv(store, dbPath, map[string]jobFunc{
+		"restore": app.runRestoreJob,
+		"archive": app.runArchiveJob,
+		"check":   app.runCheckJob,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// SIGINT/SIGTERM beenden Server und Hintergrundschleifen
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	app := &App{indexTpl: indexTpl, browseTpl: browseTpl, filesTpl: filesTpl, configTpl: configTpl, store: store}
+	if err := jobs.Start(ctx); err != nil {
+		log.Fatalf("start jobs: %v", err)
+	}
+	app.jobs = jobs
 
 	mux := http.NewServeMux()
 
@@ -73,11 +169,33 @@ func main() {
 	mux.HandleFunc("/files", app.handleFiles)
 	mux.HandleFunc("GET /config", app.handleConfigGet)
 	mux.HandleFunc("POST /config", app.handleConfigPost)
+	mux.HandleFunc("GET /configs", app.handleConfigsList)
+	mux.HandleFunc("POST /configs/{repo}/delete", app.handleConfigDelete)
+	mux.HandleFunc("POST /configs/{repo}/test", app.handleConfigTest)
 
 	mux.HandleFunc("/repositories/{repo}", app.handleSnapshots)
+	mux.HandleFunc("/repositories/{repo}/find", app.handleFind)
+	mux.HandleFunc("/repositories/{repo}/stats", app.handleStats)
+	mux.HandleFunc("/repositories/{repo}/diff", app.handleDiff)
+	mux.HandleFunc("/repositories/{repo}/history", app.handleHistory)
 	mux.HandleFunc("/repositories/{repo}/browse", app.handleBrowse)
+	mux.HandleFunc("/repositories/{repo}/search", app.handleSearch)
 	mux.HandleFunc("/repositories/{repo}/download", app.handleDownload)
 	mux.HandleFunc("/repositories/{repo}/download-zip", app.handleDownloadZip)
+	mux.HandleFunc("/repositories/{repo}/download-archive", app.handleDownloadArchive)
+	mux.HandleFunc("/repositories/{repo}/download-selected", app.handleDownloadSelected)
+	mux.HandleFunc("/repositories/{repo}/preview", app.handlePreview)
+	mux.HandleFunc("/repositories/{repo}/raw", app.handleRaw)
+	mux.HandleFunc("GET /repositories/{repo}/restore", app.handleRestoreForm)
+	mux.HandleFunc("POST /repositories/{repo}/restore", app.handleRestoreStart)
+	mux.HandleFunc("POST /repositories/{repo}/check", app.handleCheck)
+	mux.HandleFunc("GET /jobs", app.handleJobs)
+	mux.HandleFunc("GET /jobs/{id}", app.handleJob)
+	mux.HandleFunc("POST /jobs/{id}/cancel", app.handleJobCancel)
+	mux.HandleFunc("POST /jobs/{id}/delete", app.handleJobDelete)
+	mux.HandleFunc("GET /jobs/{id}/artifact", app.handleJobArtifact)
+
+	app.registerAPI(mux)
 
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200) })
 
@@ -89,8 +207,19 @@ func main() {
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
 	log.Println("Listening on http://0.0.0.0:8080")
-	log.Fatal(srv.ListenAndServe())
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
 }
 
 func withBasicAuth(next http.Handler) http.Handler {
@@ -121,19 +250,49 @@ func (a *App) handleSnapshots(w http.ResponseWriter, r *http.Request) {
 
 	if !ok {
 		a.handleRedirectToConfig(w, r, repoID)
+		return
 	}
 
 	snaps, err := ResticSnapshots(r.Context(), repo)
+	if recErr := a.store.RecordAccess(r.Context(), repoID, err); recErr != nil {
+		log.Printf("record access repo=%s err=%v", repoID, recErr)
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("restic snapshots failed: %v", err), 500)
 		return
 	}
 
+	q := r.URL.Query()
 	data := map[string]any{
-		"Body":       "index_body",
-		"Snapshots":  snaps,
-		"RepoConfig": repo,
+		"Body":           "index_body",
+		"Total":          len(snaps),
+		"RepoConfig":     repo,
+		"RestoreEnabled": len(a.restoreTargets) > 0,
+		"Hosts":          snapshotHosts(snaps),
+		"Tags":           snapshotTags(snaps),
+		"Paths":          snapshotPaths(snaps),
+		"PerPageOptions": snapshotsPerPageOptions,
+		"GroupOptions":   snapshotGroupOptions,
+	}
+
+	filter, err := parseSnapshotFilter(q)
+	data["Filter"] = filter
+	if err != nil {
+		data["Error"] = err.Error()
+		filter = SnapshotFilter{}
 	}
+	group, err := parseSnapshotGroup(q.Get("group"))
+	data["Group"] = strings.Join(group, ",")
+	if err != nil && data["Error"] == nil {
+		data["Error"] = err.Error()
+	}
+
+	filtered := filter.Apply(snaps)
+	page, pager := paginate(filtered, q)
+	data["Filtered"] = len(filtered)
+	data["Groups"] = groupSnapshots(filtered, page, group)
+	data["Pager"] = pager
+
 	if err := a.indexTpl.ExecuteTemplate(w, "snapshot.html", data); err != nil {
 		http.Error(w, err.Error(), 500)
 	}
@@ -174,7 +333,7 @@ func (a *App) handleBrowse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	entries, err := ResticList(r.Context(), repo, snap, p)
+	entries, err := a.listDir(r.Context(), repo, snap, p)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("restic ls failed: %v", err), 500)
 		return
@@ -183,20 +342,28 @@ func (a *App) handleBrowse(w http.ResponseWriter, r *http.Request) {
 	crumbs := buildBreadcrumbs(p)
 
 	data := map[string]any{
-		"Title":      "Browse",
-		"Body":       "browse_body",
-		"Snap":       snap,
-		"Path":       p,
-		"ParentPath": parent,
-		"Crumbs":     crumbs,
-		"Entries":    entries,
-		"RepoConfig": repo,
+		"Title":          "Browse",
+		"Body":           "browse_body",
+		"Snap":           snap,
+		"Path":           p,
+		"ParentPath":     parent,
+		"Crumbs":         crumbs,
+		"Entries":        entries,
+		"RepoConfig":     repo,
+		"RestoreEnabled": len(a.restoreTargets) > 0,
 	}
 	if err := a.browseTpl.ExecuteTemplate(w, "browse.html", data); err != nil {
 		http.Error(w, err.Error(), 500)
 	}
 }
 
+func formatDateTime(t time.Time) string {
+	if t.IsZero() {
+		return "—"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
 func buildBreadcrumbs(p string) []map[string]string {
 	// p is absolute restic path, e.g. "/" or "/etc/nginx/"
 	if p == "" || p[0] != '/' {
@@ -244,38 +411,3 @@ func parentPath(p string) string {
 	}
 	return "/" + strings.Join(parts[:len(parts)-1], "/") + "/"
 }
-
-func (a *App) handleDownload(w http.ResponseWriter, r *http.Request) {
-	snap := r.URL.Query().Get("snap")
-	p := r.URL.Query().Get("path")
-	if snap == "" || p == "" {
-		http.Error(w, "missing snap or path", 400)
-		return
-	}
-
-	// Force attachment filename (best-effort)
-	filename := path.Base(strings.TrimSuffix(p, "/"))
-	if filename == "" || filename == "/" || filename == "." {
-		filename = "download.bin"
-	}
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
-	// content-type unknown; browser will sniff or treat as octet-stream
-	w.Header().Set("Content-Type", "application/octet-stream")
-
-	repoID := strings.ToUpper(r.PathValue("repo"))
-	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
-	if !ok {
-		http.NotFound(w, r)
-		return
-	}
-	if err != nil {
-		http.Error(w, fmt.Sprintf("error in loading connfig: %v", err), 500)
-		return
-	}
-
-	if err := ResticDumpToWriter(r.Context(), repo, snap, p, w); err != nil {
-		// If headers already started (streaming), can't reliably http.Error.
-		log.Printf("download failed snap=%s path=%s err=%v", snap, p, err)
-		return
-	}
-}
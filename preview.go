@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Standard-Obergrenze für Vorschauen, per PREVIEW_MAX_BYTES änderbar
+	defaultPreviewMaxBytes = 10 << 20
+	// Text wird zusätzlich begrenzt, da er komplett ins HTML gerendert wird
+	previewMaxTextBytes = 2 << 20
+	sniffLen            = 512
+)
+
+// Content-Types, die /raw unverändert ausliefert. Alles andere wird als
+// text/plain ausgeliefert, damit kein HTML/JS aus Backups im Browser läuft.
+var inlineContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+}
+
+type PreviewPageModel struct {
+	Title      string
+	RepoConfig RepoConfig
+	Snap       string
+	Path       string
+	Dir        string
+	Size       int64
+	Kind       string // "text", "image", "pdf", "binary", "too_large"
+	MaxBytes   int64
+	Language   string
+	Lines      []int
+	Content    string
+}
+
+func previewMaxBytes() int64 {
+	if v := os.Getenv("PREVIEW_MAX_BYTES"); v != "" {
+		if n, err := parseSize(v); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("WARN: invalid PREVIEW_MAX_BYTES=%q, using default", v)
+	}
+	return defaultPreviewMaxBytes
+}
+
+func (a *App) handlePreview(w http.ResponseWriter, r *http.Request) {
+	snap := r.URL.Query().Get("snap")
+	p := r.URL.Query().Get("path")
+	if snap == "" || p == "" {
+		http.Error(w, "missing snap or path", 400)
+		return
+	}
+
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	entry, found, err := a.lookupEntry(r.Context(), repo, snap, p)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("restic ls failed: %v", err), 500)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	if entry.Type == "dir" {
+		http.Redirect(w, r, "browse?"+qs(map[string]string{"snap": snap, "path": normalizeDirPath(entry.Path)}), http.StatusFound)
+		return
+	}
+
+	model := PreviewPageModel{
+		Title:      "Preview",
+		RepoConfig: repo,
+		Snap:       snap,
+		Path:       entry.Path,
+		Dir:        parentPath(entry.Path),
+		Size:       entry.Size,
+		MaxBytes:   previewMaxBytes(),
+	}
+
+	if entry.Size > model.MaxBytes {
+		model.Kind = "too_large"
+	} else {
+		// Ein Dump reicht: Anfang für die Erkennung, bei Text gleich den ganzen Inhalt
+		prefix, err := dumpPrefix(r.Context(), repo, snap, entry.Path, previewMaxTextBytes)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("restic dump failed: %v", err), 500)
+			return
+		}
+		ct := http.DetectContentType(prefix)
+
+		switch {
+		case strings.HasPrefix(ct, "image/") && inlineContentTypes[ct]:
+			model.Kind = "image"
+		case ct == "application/pdf":
+			model.Kind = "pdf"
+		case !isText(ct, prefix):
+			model.Kind = "binary"
+		case entry.Size > previewMaxTextBytes:
+			model.Kind = "too_large"
+		default:
+			model.Kind = "text"
+			model.Content = string(prefix)
+			model.Language = highlightLanguage(entry.Path)
+			n := strings.Count(model.Content, "\n")
+			if !strings.HasSuffix(model.Content, "\n") {
+				n++
+			}
+			model.Lines = make([]int, n)
+			for i := range model.Lines {
+				model.Lines[i] = i + 1
+			}
+		}
+	}
+
+	if err := a.previewTpl.ExecuteTemplate(w, "preview.html", model); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+// handleRaw liefert eine Datei inline aus (für <img>/<iframe> der Vorschau).
+func (a *App) handleRaw(w http.ResponseWriter, r *http.Request) {
+	snap := r.URL.Query().Get("snap")
+	p := r.URL.Query().Get("path")
+	if snap == "" || p == "" {
+		http.Error(w, "missing snap or path", 400)
+		return
+	}
+
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	entry, found, err := a.lookupEntry(r.Context(), repo, snap, p)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("restic ls failed: %v", err), 500)
+		return
+	}
+	if !found || entry.Type == "dir" {
+		http.NotFound(w, r)
+		return
+	}
+	// große Dateien nicht inline, sondern als normaler Download
+	if entry.Size > previewMaxBytes() {
+		http.Redirect(w, r, "download?"+qs(map[string]string{"snap": snap, "path": entry.Path}), http.StatusFound)
+		return
+	}
+
+	filename := path.Base(strings.TrimSuffix(p, "/"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	sw := &sniffWriter{w: w}
+	err = ResticDumpToWriter(r.Context(), repo, snap, entry.Path, sw)
+	if err == nil {
+		err = sw.Flush()
+	}
+	if err != nil {
+		log.Printf("raw failed snap=%s path=%s err=%v", snap, p, err)
+	}
+}
+
+// sniffWriter puffert die ersten Bytes, bestimmt daraus den Content-Type und
+// schreibt erst dann die Header.
+type sniffWriter struct {
+	w       http.ResponseWriter
+	buf     []byte
+	started bool
+}
+
+func (s *sniffWriter) Write(b []byte) (int, error) {
+	if s.started {
+		return s.w.Write(b)
+	}
+	s.buf = append(s.buf, b...)
+	if len(s.buf) < sniffLen {
+		return len(b), nil
+	}
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (s *sniffWriter) Flush() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+
+	ct := http.DetectContentType(s.buf)
+	if inlineContentTypes[ct] {
+		s.w.Header().Set("Content-Type", ct)
+	} else {
+		s.w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		s.w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+	_, err := s.w.Write(s.buf)
+	s.buf = nil
+	return err
+}
+
+var errPrefixFull = errors.New("prefix buffer full")
+
+// prefixBuffer nimmt bis zu max Bytes auf und bricht danach den Dump ab.
+type prefixBuffer struct {
+	bytes.Buffer
+	max    int
+	cancel context.CancelFunc
+}
+
+func (b *prefixBuffer) Write(p []byte) (int, error) {
+	room := b.max - b.Len()
+	if len(p) > room {
+		b.Buffer.Write(p[:room])
+		b.cancel()
+		return room, errPrefixFull
+	}
+	return b.Buffer.Write(p)
+}
+
+// dumpPrefix liest höchstens n Bytes einer Datei aus dem Snapshot.
+func dumpPrefix(ctx context.Context, repo RepoConfig, snap, p string, n int) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	buf := &prefixBuffer{max: n, cancel: cancel}
+	err := ResticDumpToWriter(ctx, repo, snap, p, buf)
+	if err != nil && !errors.Is(err, errPrefixFull) {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isText(ct string, b []byte) bool {
+	switch {
+	case strings.HasPrefix(ct, "text/"),
+		strings.HasPrefix(ct, "application/json"),
+		strings.HasPrefix(ct, "application/xml"),
+		strings.HasPrefix(ct, "application/javascript"):
+		return true
+	case ct == "application/octet-stream":
+		// z.B. UTF-8 ohne erkennbare Signatur; ein am Ende abgeschnittenes Zeichen ist ok
+		b = b[:min(len(b), sniffLen)]
+		if bytes.IndexByte(b, 0) >= 0 {
+			return false
+		}
+		for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+			if utf8.Valid(b) {
+				return true
+			}
+			b = b[:len(b)-1]
+		}
+		return len(b) == 0
+	}
+	return false
+}
+
+// highlightLanguage bestimmt die highlight.js Sprache anhand der Dateiendung
+// ("" = automatische Erkennung).
+func highlightLanguage(p string) string {
+	name := strings.ToLower(path.Base(p))
+	switch name {
+	case "dockerfile":
+		return "dockerfile"
+	case "makefile":
+		return "makefile"
+	}
+	langs := map[string]string{
+		".go": "go", ".py": "python", ".js": "javascript", ".ts": "typescript",
+		".json": "json", ".yml": "yaml", ".yaml": "yaml", ".toml": "ini",
+		".ini": "ini", ".conf": "nginx", ".cfg": "ini", ".sh": "bash",
+		".bash": "bash", ".xml": "xml", ".html": "xml", ".css": "css",
+		".sql": "sql", ".md": "markdown", ".php": "php", ".rb": "ruby",
+		".rs": "rust", ".java": "java", ".c": "c", ".h": "c", ".cpp": "cpp",
+		".cs": "csharp", ".ps1": "powershell", ".diff": "diff", ".patch": "diff",
+		".properties": "properties", ".env": "bash",
+	}
+	return langs[path.Ext(name)]
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// rclone:-Repositories: restic startet selbst "rclone serve restic". Die
+// rclone.conf des Repositories liegt verschlüsselt in der Konfiguration und
+// wird nur für die Dauer eines restic-Aufrufs als Datei (0600) geschrieben,
+// rclone findet sie über RCLONE_CONFIG.
+
+const rcloneScheme = "rclone:"
+
+func isRcloneRepo(repoPath string) bool {
+	return strings.HasPrefix(repoPath, rcloneScheme)
+}
+
+// rcloneRemoteName liefert "remote" aus "rclone:remote:path/to/repo".
+func rcloneRemoteName(repoPath string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(repoPath, rcloneScheme), ":")
+	return name
+}
+
+// rcloneProgram ist der Pfad für "-o rclone.program". restic sucht rclone
+// sonst im PATH seiner (bereinigten) Umgebung; RCLONE_PROGRAM überschreibt.
+func rcloneProgram() string {
+	if p := strings.TrimSpace(os.Getenv("RCLONE_PROGRAM")); p != "" {
+		return p
+	}
+	if p, err := exec.LookPath("rclone"); err == nil {
+		return p
+	}
+	return ""
+}
+
+var rcloneSectionPattern = regexp.MustCompile(`(?m)^\s*\[([^\]]+)\]\s*$`)
+
+// validateRcloneConfig prüft, dass conf den Remote des Repositories enthält.
+// Ohne conf muss der Remote anders bekannt sein (gemountete rclone.conf unter
+// $HOME/.config/rclone), das prüft erst restic beim Speichern.
+func validateRcloneConfig(conf, repoPath string) error {
+	if strings.TrimSpace(conf) == "" {
+		return nil
+	}
+	remote := rcloneRemoteName(repoPath)
+	for _, m := range rcloneSectionPattern.FindAllStringSubmatch(conf, -1) {
+		if strings.TrimSpace(m[1]) == remote {
+			return nil
+		}
+	}
+	return fmt.Errorf("rclone.conf has no section [%s]", remote)
+}
+
+// rcloneConfigFile schreibt die rclone.conf des Repositories in eine temporäre
+// Datei und setzt RCLONE_CONFIG. cleanup löscht sie nach dem Ende von restic.
+func (p *resticProc) rcloneConfigFile() (cleanup func(), err error) {
+	if !isRcloneRepo(p.repo.Path) || p.repo.RcloneConfig == "" {
+		return func() {}, nil
+	}
+	f, err := os.CreateTemp("", "restic-browser-rclone-*.conf") // 0600
+	if err != nil {
+		return nil, fmt.Errorf("rclone config: %w", err)
+	}
+	cleanup = func() { _ = os.Remove(f.Name()) }
+
+	_, err = f.WriteString(p.repo.RcloneConfig)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("rclone config: %w", err)
+	}
+
+	p.Env = append(p.Env, "RCLONE_CONFIG="+f.Name())
+	return cleanup, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRcloneRemoteName(t *testing.T) {
+	tests := []struct{ repo, want string }{
+		{"rclone:remote:path/to/repo", "remote"},
+		{"rclone:remote:", "remote"},
+		{"rclone:my-remote:/abs/path", "my-remote"},
+		{"rclone:remote", "remote"},
+	}
+	for _, tt := range tests {
+		if got := rcloneRemoteName(tt.repo); got != tt.want {
+			t.Errorf("rcloneRemoteName(%q) = %q, want %q", tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRcloneConfig(t *testing.T) {
+	several := "[other]\ntype = local\n\n[remote]\ntype = s3\nprovider = Minio\n\n[third]\ntype = sftp\n"
+	tests := []struct {
+		name    string
+		conf    string
+		repo    string
+		wantErr bool
+	}{
+		{"empty", "", "rclone:remote:repo", false},
+		{"blank", "  \n", "rclone:remote:repo", false},
+		{"matching section", "[remote]\ntype = local\n", "rclone:remote:repo", false},
+		{"section with spaces", "  [ remote ]  \ntype = local\n", "rclone:remote:repo", false},
+		{"several sections", several, "rclone:remote:repo", false},
+		{"several sections, last", several, "rclone:third:repo", false},
+		{"no section", "type = local\n", "rclone:remote:repo", true},
+		{"other remote", "[other]\ntype = local\n", "rclone:remote:repo", true},
+		{"several sections, none matching", several, "rclone:missing:repo", true},
+		{"prefix of the name", "[remote2]\ntype = local\n", "rclone:remote:repo", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRcloneConfig(tt.conf, tt.repo)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateRcloneConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "["+rcloneRemoteName(tt.repo)+"]") {
+				t.Errorf("error %q does not name the remote", err)
+			}
+		})
+	}
+}
+
+func TestRcloneConfigFile(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	conf := "[remote]\ntype = local\n"
+	p := resticCmd(context.Background(), RepoConfig{Path: "rclone:remote:repo", RcloneConfig: conf}, "snapshots")
+
+	cleanup, err := p.rcloneConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, ok := envLookup(p.Env, "RCLONE_CONFIG")
+	if !ok {
+		t.Fatal("RCLONE_CONFIG not set")
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0o600 {
+		t.Errorf("mode = %o, want 600", mode)
+	}
+	if b, _ := os.ReadFile(file); string(b) != conf {
+		t.Errorf("content = %q, want %q", b, conf)
+	}
+
+	cleanup()
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("file still exists after cleanup: %v", err)
+	}
+}
+
+func TestRcloneConfigFileSkipped(t *testing.T) {
+	tests := []struct {
+		name string
+		repo RepoConfig
+	}{
+		{"no config", RepoConfig{Path: "rclone:remote:repo"}},
+		{"not rclone", RepoConfig{Path: "/repo/r1", RcloneConfig: "[remote]\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := resticCmd(context.Background(), tt.repo, "snapshots")
+			cleanup, err := p.rcloneConfigFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+			if v, ok := envLookup(p.Env, "RCLONE_CONFIG"); ok {
+				t.Errorf("RCLONE_CONFIG=%s set", v)
+			}
+		})
+	}
+}
+
+func TestRcloneConfigEnvRejected(t *testing.T) {
+	for _, line := range []string{
+		"RCLONE_CONFIG=/tmp/other.conf",
+		"RCLONE_CONFIG_PASS=secret",
+		"RCLONE_CONFIG_REMOTE_TYPE=local",
+	} {
+		if _, err := parseRepoEnv(line, nil); err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("parseRepoEnv(%q) error = %v, want not allowed", line, err)
+		}
+	}
+	if _, err := parseRepoEnv("RCLONE_BWLIMIT=1M", nil); err != nil {
+		t.Errorf("parseRepoEnv(RCLONE_BWLIMIT) = %v", err)
+	}
+}
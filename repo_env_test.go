@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRepoEnvNameAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"AWS_ACCESS_KEY_ID", true},
+		{"B2_ACCOUNT_KEY", true},
+		{"RESTIC_COMPRESSION", true},
+		{"RESTIC_REST_PASSWORD", true},
+		{"RCLONE_BWLIMIT", true},
+		{"RESTIC_PASSWORD", false},
+		{"RESTIC_PASSWORD_FILE", false},
+		{"RESTIC_PASSWORD_COMMAND", false},
+		{"RESTIC_REPOSITORY", false},
+		{"RESTIC_REPOSITORY_FILE", false},
+		{"RCLONE_CONFIG", false},
+		{"RCLONE_CONFIG_PASS", false},
+		{"RCLONE_CONFIG_REMOTE_TYPE", false},
+		{"PATH", false},
+		{"LD_PRELOAD", false},
+	}
+	for _, tt := range tests {
+		if got := repoEnvNameAllowed(tt.name); got != tt.want {
+			t.Errorf("repoEnvNameAllowed(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRepoEnv(t *testing.T) {
+	old := []string{"AWS_SECRET_ACCESS_KEY=stored"}
+	tests := []struct {
+		name    string
+		text    string
+		want    []string
+		wantErr string
+	}{
+		{"empty", "\n# comment\n", nil, ""},
+		{"sorted", "B2_ACCOUNT_ID=b\nAWS_ACCESS_KEY_ID=a\n", []string{"AWS_ACCESS_KEY_ID=a", "B2_ACCOUNT_ID=b"}, ""},
+		{"keep redacted", "AWS_SECRET_ACCESS_KEY=***", []string{"AWS_SECRET_ACCESS_KEY=stored"}, ""},
+		{"redacted without stored value", "B2_ACCOUNT_KEY=***", nil, "no stored value"},
+		{"not allowed", "RCLONE_CONFIG=/tmp/x", nil, "not allowed"},
+		{"password", "RESTIC_PASSWORD=x", nil, "not allowed"},
+		{"twice", "AWS_ACCESS_KEY_ID=a\nAWS_ACCESS_KEY_ID=b", nil, "set twice"},
+		{"no value", "AWS_ACCESS_KEY_ID", nil, "expected NAME=value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRepoEnv(tt.text, old)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseRepoEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseRepoEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResticEnvForRepoIsolated(t *testing.T) {
+	t.Setenv("RESTIC_PASSWORD", "from-process")
+	t.Setenv("RESTIC_PASSWORD_FILE", "/run/secrets/pw")
+	t.Setenv("RESTIC_REPOSITORY", "/repo/other")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "from-process")
+	t.Setenv("HOME", "/home/test")
+
+	env := resticEnvForRepo(RepoConfig{
+		Path: "/repo/r1",
+		Env:  []string{"AWS_ACCESS_KEY_ID=id", "RCLONE_CONFIG_X_TYPE=local"},
+	})
+
+	for _, name := range []string{"RESTIC_PASSWORD", "RESTIC_PASSWORD_FILE", "AWS_SECRET_ACCESS_KEY", "RCLONE_CONFIG_X_TYPE"} {
+		if v, ok := envLookup(env, name); ok {
+			t.Errorf("%s=%s inherited", name, v)
+		}
+	}
+	for name, want := range map[string]string{
+		"RESTIC_REPOSITORY": "/repo/r1",
+		"AWS_ACCESS_KEY_ID": "id",
+		"HOME":              "/home/test",
+	} {
+		if v, _ := envLookup(env, name); v != want {
+			t.Errorf("%s = %q, want %q", name, v, want)
+		}
+	}
+}
+
+func TestResticEnvForRepoURLPassword(t *testing.T) {
+	env := resticEnvForRepo(RepoConfig{Path: "rest:https://user:pw@backup.example.com/repo"})
+	for _, kv := range env {
+		if strings.Contains(kv, "pw@") {
+			t.Errorf("URL password in env: %s", kv)
+		}
+	}
+
+	p := resticCmd(context.Background(), RepoConfig{Password: "secret", Path: "rest:https://user:pw@backup.example.com/repo"}, "snapshots")
+	want := []string{"--password-file", "/dev/fd/3", "--repository-file", "/dev/fd/4"}
+	if !slices.Equal(p.args[:4], want) {
+		t.Errorf("args = %q, want prefix %q", p.args, want)
+	}
+	if !slices.Equal(p.secrets, []string{"secret", "rest:https://user:pw@backup.example.com/repo"}) {
+		t.Errorf("secrets = %q", p.secrets)
+	}
+}
@@ -1,17 +1,19 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,6 +25,31 @@ type Snapshot struct {
 	Paths    []string  `json:"paths"`
 	Tags     []string  `json:"tags"`
 	ShortID  string    `json:"short_id"`
+
+	// Nur bei Snapshots ab restic 0.17 vorhanden
+	Summary *SnapshotSummary `json:"summary,omitempty"`
+}
+
+type SnapshotSummary struct {
+	BackupStart         time.Time `json:"backup_start"`
+	BackupEnd           time.Time `json:"backup_end"`
+	FilesNew            int64     `json:"files_new"`
+	FilesChanged        int64     `json:"files_changed"`
+	DataAdded           int64     `json:"data_added"`
+	DataAddedPacked     int64     `json:"data_added_packed"`
+	TotalFilesProcessed int64     `json:"total_files_processed"`
+	TotalBytesProcessed int64     `json:"total_bytes_processed"`
+}
+
+// ResticStatsResult ist die Ausgabe von "restic stats --json"; welche Felder
+// gefüllt sind, hängt vom Modus ab.
+type ResticStatsResult struct {
+	TotalSize             int64   `json:"total_size"`
+	TotalUncompressedSize int64   `json:"total_uncompressed_size"`
+	TotalFileCount        int64   `json:"total_file_count"`
+	TotalBlobCount        int64   `json:"total_blob_count"`
+	SnapshotsCount        int     `json:"snapshots_count"`
+	CompressionRatio      float64 `json:"compression_ratio"`
 }
 
 type LsEntry struct {
@@ -45,6 +72,83 @@ type resticLsEvent struct {
 	Mtime string `json:"mtime,omitempty"`
 }
 
+// FindMatch ist ein Treffer aus "restic find --json".
+type FindMatch struct {
+	Path  string    `json:"path"`
+	Type  string    `json:"type"`
+	Size  int64     `json:"size"`
+	Mode  int       `json:"mode"`
+	Mtime time.Time `json:"mtime"`
+}
+
+type FindResult struct {
+	Snapshot string      `json:"snapshot"`
+	Hits     int         `json:"hits"`
+	Matches  []FindMatch `json:"matches"`
+}
+
+// DiffChange ist eine "change" Nachricht aus "restic diff --json".
+// Modifier: "+" hinzugefügt, "-" entfernt, "M" Inhalt geändert, "T" Typ geändert,
+// "U" nur Metadaten geändert.
+type DiffChange struct {
+	Path     string `json:"path"`
+	Modifier string `json:"modifier"`
+}
+
+type DiffStatsCount struct {
+	Files int   `json:"files"`
+	Dirs  int   `json:"dirs"`
+	Bytes int64 `json:"bytes"`
+}
+
+type DiffStats struct {
+	ChangedFiles int            `json:"changed_files"`
+	Added        DiffStatsCount `json:"added"`
+	Removed      DiffStatsCount `json:"removed"`
+}
+
+type resticDiffEvent struct {
+	MessageType string `json:"message_type"`
+	DiffChange
+	DiffStats
+}
+
+// TreeNode ist ein Knoten aus "restic cat tree". Im Gegensatz zu ls enthält er
+// die Content-Blob-IDs, über die sich Dateiversionen vergleichen lassen.
+type TreeNode struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Mode    int       `json:"mode"`
+	Mtime   time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+	Content []string  `json:"content"`
+
+	LinkTarget string `json:"linktarget,omitempty"`
+}
+
+// RestoreProgress entspricht den "status"- und "summary"-Meldungen von
+// "restic restore --json" (restic >= 0.17).
+type RestoreProgress struct {
+	SecondsElapsed int64   `json:"seconds_elapsed"`
+	PercentDone    float64 `json:"percent_done"`
+	TotalFiles     int64   `json:"total_files"`
+	FilesRestored  int64   `json:"files_restored"`
+	FilesSkipped   int64   `json:"files_skipped"`
+	TotalBytes     int64   `json:"total_bytes"`
+	BytesRestored  int64   `json:"bytes_restored"`
+	BytesSkipped   int64   `json:"bytes_skipped"`
+}
+
+type resticRestoreEvent struct {
+	MessageType string `json:"message_type"`
+	RestoreProgress
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	During string `json:"during"`
+	Item   string `json:"item"`
+}
+
 func isResticRepoRoot(dir string) bool {
 	// Minimal robust: config + typische Ordner
 	if _, err := os.Stat(filepath.Join(dir, "config")); err != nil {
@@ -69,39 +173,170 @@ func resticNoLockEnabled() bool {
 	return v == "1" || v == "true" || v == "yes" || v == "on"
 }
 
-func resticEnvForRepo(repo RepoConfig) []string {
-	env := os.Environ()
+func resticArgsForRepo(repo RepoConfig, args ...string) []string {
+	if repo.NoLock {
+		return append([]string{"--no-lock"}, args...)
+	}
+	return args
+}
 
-	if repo.Password != "" {
-		env = append(env, "RESTIC_PASSWORD="+repo.Password)
+// -------------------- Errors --------------------
+
+var (
+	ErrResticNotFound = errors.New("restic binary not found")
+	ErrWrongPassword  = errors.New("wrong password or no key found")
+	ErrNotARepository = errors.New("not a restic repository")
+)
+
+// Exit codes seit restic 0.17
+const (
+	resticExitRepoNotFound  = 10
+	resticExitWrongPassword = 12
+)
+
+// classifyResticError ordnet einen fehlgeschlagenen restic-Aufruf einem der
+// bekannten Fehler zu (per Exit code, ältere Versionen per stderr-Text).
+func classifyResticError(err error, stderr []byte) error {
+	msg := strings.TrimSpace(string(stderr))
+
+	if errors.Is(err, exec.ErrNotFound) {
+		return ErrResticNotFound
 	}
 
-	if repo.Path != "" {
-		env = append(env, "RESTIC_REPOSITORY="+repo.Path)
+	code := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
 	}
 
-	if cache := os.Getenv("RESTIC_CACHE_DIR"); cache != "" {
-		env = append(env, "RESTIC_CACHE_DIR="+cache)
+	lower := strings.ToLower(msg)
+	switch {
+	case code == resticExitWrongPassword || strings.Contains(lower, "wrong password"):
+		return fmt.Errorf("%w: %s", ErrWrongPassword, msg)
+	case code == resticExitRepoNotFound ||
+		strings.Contains(lower, "repository does not exist") ||
+		strings.Contains(lower, "unable to open config file") ||
+		strings.Contains(lower, "is there a repository at the following location"):
+		return fmt.Errorf("%w: %s", ErrNotARepository, msg)
 	}
+	return fmt.Errorf("%w: %s", err, msg)
+}
 
-	log.Printf("environment: %s", env)
+// -------------------- Process runner --------------------
 
-	return env
+// resticProc ist ein vorbereiteter restic-Prozess. Run bzw. Start/Wait
+// protokollieren den Aufruf nach dem Ende.
+type resticProc struct {
+	*exec.Cmd
+	ctx   context.Context
+	repo  RepoConfig
+	args  []string
+	start time.Time
+
+	cleanup func()   // temporäre Dateien, nach dem Ende von restic
+	secrets []string // Inhalt der Pipes ab fd 3, in dieser Reihenfolge
 }
 
-func resticArgsForRepo(repo RepoConfig, args ...string) []string {
-	if repo.NoLock {
-		return append([]string{"--no-lock"}, args...)
+// Passwort und eine Repository-URL mit Passwort gehen über Pipes ab fd 3 an
+// restic (--password-file, --repository-file), nicht über RESTIC_PASSWORD oder
+// RESTIC_REPOSITORY: die Umgebung ist für andere Prozesse im Container in
+// /proc/<pid>/environ lesbar.
+const resticFirstSecretFD = 3
+
+// resticCmd baut den restic-Aufruf für repo: --no-lock, Passwort, Umgebung und
+// Logging kommen zentral von hier, die Runner setzen nur noch stdout/stderr.
+func resticCmd(ctx context.Context, repo RepoConfig, args ...string) *resticProc {
+	var prefix, secrets []string
+	secretFile := func(flag, value string) {
+		prefix = append(prefix, flag, fmt.Sprintf("/dev/fd/%d", resticFirstSecretFD+len(secrets)))
+		secrets = append(secrets, value)
 	}
-	return args
+	if repo.Password != "" {
+		secretFile("--password-file", repo.Password)
+	}
+	if repoURLHasPassword(repo.Path) {
+		secretFile("--repository-file", repo.Path)
+	}
+	if isRcloneRepo(repo.Path) {
+		if prog := rcloneProgram(); prog != "" {
+			prefix = append(prefix, "-o", "rclone.program="+prog)
+		}
+	}
+	finalArgs := append(prefix, resticArgsForRepo(repo, args...)...)
+
+	cmd := exec.CommandContext(ctx, "restic", finalArgs...)
+	cmd.Env = resticEnvForRepo(repo)
+	return &resticProc{Cmd: cmd, ctx: ctx, repo: repo, args: finalArgs, secrets: secrets}
 }
 
-// -------------------- Process runner --------------------
+func (p *resticProc) Start() error {
+	p.start = time.Now()
+	p.logStart()
+
+	var err error
+	if p.cleanup, err = p.rcloneConfigFile(); err != nil {
+		p.logDone(err)
+		return err
+	}
+
+	closePipes, err := p.secretPipes()
+	if err == nil {
+		err = p.Cmd.Start()
+		closePipes()
+	}
+	if err != nil {
+		p.cleanup()
+		p.logDone(err)
+	}
+	return err
+}
+
+// secretPipes hängt für jedes Secret das Leseende einer Pipe an den Prozess
+// (ab fd 3) und schreibt das Secret hinein. cleanup schließt die Kopien im
+// eigenen Prozess, sobald restic gestartet ist; nach dem Ende von restic sind
+// die Pipes weg.
+func (p *resticProc) secretPipes() (cleanup func(), err error) {
+	var readers []*os.File
+	cleanup = func() {
+		for _, r := range readers {
+			_ = r.Close()
+		}
+	}
+	for _, secret := range p.secrets {
+		r, w, err := os.Pipe()
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("secret pipe: %w", err)
+		}
+		readers = append(readers, r)
+
+		go func() {
+			// Passt praktisch immer in den Pipe-Puffer. Beendet sich restic, ohne
+			// zu lesen, liefert Write EPIPE statt zu blockieren.
+			_, _ = io.WriteString(w, secret)
+			_ = w.Close()
+		}()
+	}
+	p.ExtraFiles = readers
+	return cleanup, nil
+}
+
+func (p *resticProc) Wait() error {
+	err := p.Cmd.Wait()
+	p.cleanup()
+	p.logDone(err)
+	return err
+}
+
+func (p *resticProc) Run() error {
+	if err := p.Start(); err != nil {
+		return err
+	}
+	return p.Wait()
+}
 
 func runRestic(ctx context.Context, repo RepoConfig, args ...string) ([]byte, []byte, error) {
-	finalArgs := resticArgsForRepo(repo, args...)
-	cmd := exec.CommandContext(ctx, "restic", finalArgs...)
-	cmd.Env = resticEnvForRepo(repo)
+	cmd := resticCmd(ctx, repo, args...)
 
 	var out bytes.Buffer
 	var errb bytes.Buffer
@@ -112,12 +347,41 @@ func runRestic(ctx context.Context, repo RepoConfig, args ...string) ([]byte, []
 	return out.Bytes(), errb.Bytes(), err
 }
 
+// streamRestic leitet stdout von restic direkt nach w, ohne zu puffern.
+func streamRestic(ctx context.Context, repo RepoConfig, w io.Writer, args ...string) error {
+	cmd := resticCmd(ctx, repo, args...)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	_, copyErr := io.Copy(w, stdout)
+	if copyErr != nil {
+		// restic nicht blockiert im vollen Pipe-Puffer hängen lassen
+		_ = cmd.Process.Kill()
+	}
+	waitErr := cmd.Wait()
+
+	if copyErr != nil {
+		return copyErr
+	}
+	if waitErr != nil {
+		return waitErr
+	}
+	return nil
+}
+
 // -------------------- API --------------------
 
 func ResticSnapshots(ctx context.Context, repo RepoConfig) ([]Snapshot, error) {
 	out, errb, err := runRestic(ctx, repo, "snapshots", "--json")
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", err, string(errb))
+		return nil, classifyResticError(err, errb)
 	}
 
 	var snaps []Snapshot
@@ -137,12 +401,34 @@ func ResticSnapshots(ctx context.Context, repo RepoConfig) ([]Snapshot, error) {
 	return snaps, nil
 }
 
+// ResticCatConfig liest die Repository-Konfiguration. Billiger Test, ob Pfad und
+// Passwort stimmen; Fehler werden per classifyResticError eingeordnet.
+func ResticCatConfig(ctx context.Context, repo RepoConfig) error {
+	_, errb, err := runRestic(ctx, repo, "cat", "config")
+	if err != nil {
+		return classifyResticError(err, errb)
+	}
+	return nil
+}
+
 func ResticList(ctx context.Context, repo RepoConfig, snapshotID, p string) ([]LsEntry, error) {
 	out, errb, err := runRestic(ctx, repo, "ls", snapshotID, p, "--json")
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", err, string(errb))
+		return nil, classifyResticError(err, errb)
 	}
+	return parseLsOutput(out)
+}
 
+// ResticListRecursive listet den kompletten Snapshot (ls ohne Pfad ist rekursiv).
+func ResticListRecursive(ctx context.Context, repo RepoConfig, snapshotID string) ([]LsEntry, error) {
+	out, errb, err := runRestic(ctx, repo, "ls", snapshotID, "--json")
+	if err != nil {
+		return nil, classifyResticError(err, errb)
+	}
+	return parseLsOutput(out)
+}
+
+func parseLsOutput(out []byte) ([]LsEntry, error) {
 	dec := json.NewDecoder(bytes.NewReader(out))
 
 	var entries []LsEntry
@@ -169,27 +455,237 @@ func ResticList(ctx context.Context, repo RepoConfig, snapshotID, p string) ([]L
 	return entries, nil
 }
 
+// ResticFind sucht pattern mit einem einzigen restic-Prozess in allen Snapshots,
+// die zu Host, Tag und Pfad des Filters passen. Den Zeitraum kennt restic find
+// nicht, den filtert der Aufrufer über FindResult.Snapshot.
+func ResticFind(ctx context.Context, repo RepoConfig, pattern string, ignoreCase bool, f SnapshotFilter) ([]FindResult, error) {
+	args := []string{"find", "--json"}
+	if ignoreCase {
+		args = append(args, "--ignore-case")
+	}
+	if f.Host != "" {
+		args = append(args, "--host", f.Host)
+	}
+	if f.Tag != "" {
+		args = append(args, "--tag", f.Tag)
+	}
+	if f.Path != "" {
+		args = append(args, "--path", f.Path)
+	}
+	args = append(args, "--", pattern)
+
+	out, errb, err := runRestic(ctx, repo, args...)
+	if err != nil {
+		return nil, classifyResticError(err, errb)
+	}
+
+	var results []FindResult
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+	if e := json.Unmarshal(out, &results); e != nil {
+		return nil, fmt.Errorf("parse json: %w", e)
+	}
+	return results, nil
+}
+
+func ResticDiff(ctx context.Context, repo RepoConfig, snapA, snapB string) ([]DiffChange, DiffStats, error) {
+	out, errb, err := runRestic(ctx, repo, "diff", "--json", snapA, snapB)
+	if err != nil {
+		return nil, DiffStats{}, classifyResticError(err, errb)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+
+	var changes []DiffChange
+	var stats DiffStats
+	for dec.More() {
+		var ev resticDiffEvent
+		if err := dec.Decode(&ev); err != nil {
+			return nil, DiffStats{}, fmt.Errorf("parse ndjson: %w", err)
+		}
+		switch ev.MessageType {
+		case "change":
+			changes = append(changes, ev.DiffChange)
+		case "statistics":
+			stats = ev.DiffStats
+		}
+	}
+	return changes, stats, nil
+}
+
+// ResticCatTree liest den Tree eines Ordners im Snapshot ("cat tree snap:/dir",
+// benötigt restic >= 0.17).
+func ResticCatTree(ctx context.Context, repo RepoConfig, snapshotID, dir string) ([]TreeNode, error) {
+	out, errb, err := runRestic(ctx, repo, "cat", "tree", snapshotID+":"+dir)
+	if err != nil {
+		return nil, classifyResticError(err, errb)
+	}
+
+	var tree struct {
+		Nodes []TreeNode `json:"nodes"`
+	}
+	if e := json.Unmarshal(out, &tree); e != nil {
+		return nil, fmt.Errorf("parse json: %w", e)
+	}
+	return tree.Nodes, nil
+}
+
 func ResticDumpToWriter(ctx context.Context, repo RepoConfig, snapshotID, p string, w io.Writer) error {
-	cmd := exec.CommandContext(ctx, "restic", resticArgsForRepo(repo, "dump", snapshotID, p)...)
-	cmd.Env = resticEnvForRepo(repo)
-	cmd.Stderr = os.Stderr
+	return streamRestic(ctx, repo, w, "dump", snapshotID, p)
+}
+
+// ResticDumpArchive schreibt einen ganzen Ordner als Archiv ("tar" oder "zip")
+// mit einem einzigen restic-Prozess nach w.
+func ResticDumpArchive(ctx context.Context, repo RepoConfig, snapshotID, dir, format string, w io.Writer) error {
+	return streamRestic(ctx, repo, w, "dump", "--archive", format, snapshotID, dir)
+}
+
+// ResticRestore stellt snapshotID (optional nur include) nach target wieder her.
+// onProgress bekommt jede Status-Meldung, die Summary als letzte mit
+// PercentDone = 1; Fehler zu einzelnen Dateien gehen an onError.
+func ResticRestore(ctx context.Context, repo RepoConfig, snapshotID, target, include, overwrite string,
+	onProgress func(RestoreProgress), onError func(item, msg string)) error {
+	args := []string{"restore", snapshotID, "--target", target, "--json"}
+	if include != "" {
+		args = append(args, "--include", include)
+	}
+	if overwrite != "" {
+		args = append(args, "--overwrite", overwrite)
+	}
+
+	cmd := resticCmd(ctx, repo, args...)
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
 	}
 	if err := cmd.Start(); err != nil {
-		return err
+		return classifyResticError(err, nil)
 	}
 
-	_, copyErr := io.Copy(w, stdout)
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var ev resticRestoreEvent
+		if json.Unmarshal(sc.Bytes(), &ev) != nil {
+			continue
+		}
+		switch ev.MessageType {
+		case "status":
+			onProgress(ev.RestoreProgress)
+		case "summary":
+			ev.PercentDone = 1
+			onProgress(ev.RestoreProgress)
+		}
+	}
+	_, _ = io.Copy(io.Discard, stdout)
 	waitErr := cmd.Wait()
 
-	if copyErr != nil {
-		return copyErr
+	// Fehlermeldungen landen (auch im JSON-Modus) auf stderr
+	var rest []string
+	for _, line := range strings.Split(errb.String(), "\n") {
+		var ev resticRestoreEvent
+		if json.Unmarshal([]byte(line), &ev) == nil && ev.MessageType == "error" {
+			onError(ev.Item, ev.Error.Message)
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			rest = append(rest, line)
+		}
 	}
+
 	if waitErr != nil {
-		return waitErr
+		return classifyResticError(waitErr, []byte(strings.Join(rest, "\n")))
 	}
 	return nil
 }
+
+// ResticCheck prüft das Repository, optional inkl. eines Teils der Daten
+// (--read-data-subset, z.B. "5%" oder "1/10"). Jede Ausgabezeile (stdout und
+// stderr) geht an onLine.
+func ResticCheck(ctx context.Context, repo RepoConfig, readDataSubset string, onLine func(string)) error {
+	args := []string{"check"}
+	if readDataSubset != "" {
+		args = append(args, "--read-data-subset", readDataSubset)
+	}
+
+	cmd := resticCmd(ctx, repo, args...)
+
+	// stdout und stderr werden parallel kopiert, onLine aber nie gleichzeitig aufgerufen
+	var mu sync.Mutex
+	emit := func(l string) {
+		mu.Lock()
+		defer mu.Unlock()
+		onLine(l)
+	}
+	out := &lineWriter{fn: emit}
+	errw := &lineWriter{fn: emit, keep: 5}
+	cmd.Stdout = out
+	cmd.Stderr = errw
+
+	err := cmd.Run()
+	out.Flush()
+	errw.Flush()
+	if err != nil {
+		return classifyResticError(err, []byte(strings.Join(errw.last, "\n")))
+	}
+	return nil
+}
+
+// lineWriter ruft fn für jede vollständige Zeile auf und merkt sich die letzten
+// keep Zeilen für Fehlermeldungen.
+type lineWriter struct {
+	fn   func(string)
+	keep int
+	buf  []byte
+	last []string
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.line(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+}
+
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.line(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) line(l string) {
+	l = strings.TrimRight(l, "\r")
+	if strings.TrimSpace(l) == "" {
+		return
+	}
+	w.fn(l)
+	if w.keep > 0 {
+		w.last = append(w.last, l)
+		if len(w.last) > w.keep {
+			w.last = w.last[1:]
+		}
+	}
+}
+
+// ResticStats liefert "restic stats" im Modus "restore-size" oder "raw-data".
+func ResticStats(ctx context.Context, repo RepoConfig, mode string) (ResticStatsResult, error) {
+	out, errb, err := runRestic(ctx, repo, "stats", "--json", "--mode", mode)
+	if err != nil {
+		return ResticStatsResult{}, classifyResticError(err, errb)
+	}
+	var st ResticStatsResult
+	if e := json.Unmarshal(out, &st); e != nil {
+		return ResticStatsResult{}, fmt.Errorf("parse json: %w", e)
+	}
+	return st, nil
+}
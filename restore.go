@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Restore schreibt Snapshot-Inhalte auf den Server, aber nur in Ordner aus
+// RESTORE_TARGETS (kommagetrennt, z.B. "/restore"). Ohne die Variable ist
+// Restore abgeschaltet.
+
+// Höchstens so viele Fehlermeldungen pro Restore ins Job-Log schreiben
+const maxRestoreErrors = 100
+
+var restoreOverwriteModes = []string{"if-changed", "if-newer", "never", "always"}
+
+type RestoreFormModel struct {
+	Title      string
+	RepoConfig RepoConfig
+	Snap       string
+	Path       string
+	Type       string
+	Targets    []string
+	Overwrite  []string
+	Error      string
+}
+
+// restoreTargetsFromEnv liest RESTORE_TARGETS. Relative Pfade und Ordner im
+// read-only Repository-Mount werden ignoriert.
+func restoreTargetsFromEnv() []string {
+	const repoRoot = "/repo"
+	var targets []string
+	for _, t := range strings.Split(os.Getenv("RESTORE_TARGETS"), ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		t = filepath.Clean(t)
+		if !filepath.IsAbs(t) {
+			log.Printf("WARN: RESTORE_TARGETS entry %q is not absolute, ignored", t)
+			continue
+		}
+		if t == repoRoot || strings.HasPrefix(t, repoRoot+"/") {
+			log.Printf("WARN: RESTORE_TARGETS entry %q is inside %s, ignored", t, repoRoot)
+			continue
+		}
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// resolveRestoreTarget prüft target gegen die Allow-List und hängt den
+// optionalen Unterordner an, ohne dass dieser aus dem Ziel herausführen kann.
+func (a *App) resolveRestoreTarget(target, sub string) (string, error) {
+	allowed := false
+	for _, t := range a.restoreTargets {
+		if t == target {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("target %q is not allowed", target)
+	}
+
+	sub = strings.Trim(strings.TrimSpace(sub), "/")
+	if sub == "" {
+		return target, nil
+	}
+	if !filepath.IsLocal(sub) {
+		return "", fmt.Errorf("invalid subdirectory %q", sub)
+	}
+	return filepath.Join(target, sub), nil
+}
+
+// restoreInclude maskiert Pattern-Zeichen, damit --include genau den Pfad trifft.
+func restoreInclude(p string) string {
+	r := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+	return r.Replace(p)
+}
+
+func (a *App) handleRestoreForm(w http.ResponseWriter, r *http.Request) {
+	snap := r.URL.Query().Get("snap")
+	if snap == "" {
+		http.Error(w, "missing snap", 400)
+		return
+	}
+	p := path.Clean("/" + r.URL.Query().Get("path"))
+
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	typ := "snapshot"
+	if p != "/" {
+		e, found, err := a.lookupEntry(r.Context(), repo, snap, p)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		typ = e.Type
+	}
+
+	a.renderRestoreForm(w, RestoreFormModel{
+		Title:      "Restore",
+		RepoConfig: repo,
+		Snap:       snap,
+		Path:       p,
+		Type:       typ,
+	})
+}
+
+func (a *App) renderRestoreForm(w http.ResponseWriter, m RestoreFormModel) {
+	m.Targets = a.restoreTargets
+	m.Overwrite = restoreOverwriteModes
+	if err := a.restoreTpl.ExecuteTemplate(w, "restore.html", m); err != nil {
+		http.Error(w, fmt.Sprintf("template error: %v", err), 500)
+	}
+}
+
+func (a *App) handleRestoreStart(w http.ResponseWriter, r *http.Request) {
+	if len(a.restoreTargets) == 0 {
+		http.Error(w, "restore is disabled (RESTORE_TARGETS not set)", 403)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", 400)
+		return
+	}
+	snap := r.FormValue("snap")
+	if snap == "" {
+		http.Error(w, "missing snap", 400)
+		return
+	}
+	p := path.Clean("/" + r.FormValue("path"))
+	overwrite := r.FormValue("overwrite")
+
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	model := RestoreFormModel{
+		Title:      "Restore",
+		RepoConfig: repo,
+		Snap:       snap,
+		Path:       p,
+		Type:       r.FormValue("type"),
+	}
+
+	validOverwrite := false
+	for _, m := range restoreOverwriteModes {
+		validOverwrite = validOverwrite || m == overwrite
+	}
+	if !validOverwrite {
+		model.Error = "Invalid overwrite mode."
+		a.renderRestoreForm(w, model)
+		return
+	}
+	if r.FormValue("confirm") != "yes" {
+		model.Error = "Please confirm the restore."
+		a.renderRestoreForm(w, model)
+		return
+	}
+	target, err := a.resolveRestoreTarget(r.FormValue("target"), r.FormValue("subdir"))
+	if err != nil {
+		model.Error = err.Error()
+		a.renderRestoreForm(w, model)
+		return
+	}
+
+	j, err := a.jobs.Submit(r.Context(), "restore", repo.ID, JobParams{
+		Snap:      snap,
+		Path:      p,
+		Target:    target,
+		Overwrite: overwrite,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("submit job failed: %v", err), 500)
+		return
+	}
+	http.Redirect(w, r, "/jobs/"+j.ID, http.StatusSeeOther)
+}
+
+// runRestoreJob führt "restic restore" als Hintergrund-Job aus.
+func (a *App) runRestoreJob(ctx context.Context, jc *jobContext) error {
+	j := jc.Job()
+	repo, ok, err := a.store.GetRepo(ctx, j.RepoID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("repository %s is not configured", j.RepoID)
+	}
+
+	// Ziel erneut gegen die Allow-List prüfen, sie kann sich seit dem Einreihen geändert haben
+	allowed := false
+	for _, t := range a.restoreTargets {
+		allowed = allowed || j.Params.Target == t || strings.HasPrefix(j.Params.Target, t+"/")
+	}
+	if !allowed {
+		return fmt.Errorf("target %s is no longer allowed", j.Params.Target)
+	}
+
+	include := ""
+	if j.Params.Path != "/" {
+		include = restoreInclude(j.Params.Path)
+	}
+
+	jc.Logf("restore %s:%s to %s (overwrite: %s)", j.Params.Snap, j.Params.Path, j.Params.Target, j.Params.Overwrite)
+	errCount := 0
+	err = ResticRestore(ctx, repo, j.Params.Snap, j.Params.Target, include, j.Params.Overwrite,
+		func(pr RestoreProgress) {
+			jc.Progress(pr.PercentDone, fmt.Sprintf("%d/%d files, %s/%s restored, %d skipped",
+				pr.FilesRestored, pr.TotalFiles, formatBytes(pr.BytesRestored), formatBytes(pr.TotalBytes), pr.FilesSkipped))
+		},
+		func(item, msg string) {
+			if errCount++; errCount <= maxRestoreErrors {
+				jc.Logf("error: %s", strings.TrimSpace(item+": "+msg))
+			}
+		})
+	if err != nil {
+		return err
+	}
+	if errCount > 0 {
+		return fmt.Errorf("restore finished with %d error(s), see log", errCount)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maximale Anzahl an Treffern, die auf der Suchseite angezeigt werden
+const searchResultLimit = 1000
+
+type SearchQuery struct {
+	Pattern    string
+	Mode       string // "glob" oder "regex"
+	IgnoreCase bool
+	Scope      string // nur unterhalb dieses Ordners suchen ("/" = alles)
+	MinSize    string
+	MaxSize    string
+	After      string // YYYY-MM-DD, mtime >= After
+	Before     string // YYYY-MM-DD, mtime < Before + 1 Tag
+
+	re                   *regexp.Regexp
+	minSize, maxSize     int64
+	afterT, beforeT      time.Time
+	matchAgainstFullPath bool
+}
+
+type SearchHit struct {
+	LsEntry
+	Dir     string // Ordner, in dem der Treffer liegt
+	ModTime time.Time
+}
+
+type SearchPageModel struct {
+	Title      string
+	RepoConfig RepoConfig
+	Snap       string
+	Query      SearchQuery
+	Searched   bool
+	Hits       []SearchHit
+	Truncated  bool
+	Error      string
+}
+
+func parseSearchQuery(v url.Values) (SearchQuery, error) {
+	q := SearchQuery{
+		Pattern:    strings.TrimSpace(v.Get("q")),
+		Mode:       v.Get("mode"),
+		IgnoreCase: v.Get("icase") == "on",
+		Scope:      normalizeDirPath(v.Get("path")),
+		MinSize:    strings.TrimSpace(v.Get("min_size")),
+		MaxSize:    strings.TrimSpace(v.Get("max_size")),
+		After:      strings.TrimSpace(v.Get("after")),
+		Before:     strings.TrimSpace(v.Get("before")),
+		minSize:    -1,
+		maxSize:    -1,
+	}
+	if q.Mode != "regex" {
+		q.Mode = "glob"
+	}
+
+	switch q.Mode {
+	case "glob":
+		pat := q.Pattern
+		if q.IgnoreCase {
+			pat = strings.ToLower(pat)
+		}
+		if _, err := path.Match(pat, ""); err != nil {
+			return q, fmt.Errorf("invalid glob pattern: %w", err)
+		}
+		// Muster mit "/" beziehen sich auf den ganzen Pfad, sonst nur auf den Namen
+		q.matchAgainstFullPath = strings.Contains(q.Pattern, "/")
+	case "regex":
+		expr := q.Pattern
+		if q.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return q, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		q.re = re
+	}
+
+	var err error
+	if q.MinSize != "" {
+		if q.minSize, err = parseSize(q.MinSize); err != nil {
+			return q, fmt.Errorf("min size: %w", err)
+		}
+	}
+	if q.MaxSize != "" {
+		if q.maxSize, err = parseSize(q.MaxSize); err != nil {
+			return q, fmt.Errorf("max size: %w", err)
+		}
+	}
+	if q.After != "" {
+		if q.afterT, err = time.ParseInLocation("2006-01-02", q.After, time.Local); err != nil {
+			return q, fmt.Errorf("modified after: %w", err)
+		}
+	}
+	if q.Before != "" {
+		if q.beforeT, err = time.ParseInLocation("2006-01-02", q.Before, time.Local); err != nil {
+			return q, fmt.Errorf("modified before: %w", err)
+		}
+		q.beforeT = q.beforeT.AddDate(0, 0, 1)
+	}
+	return q, nil
+}
+
+// parseSize versteht Bytes sowie die Suffixe K, M, G, T (Basis 1024), z.B. "1.5G".
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := 1.0
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || f < 0 {
+		return 0, errors.New("invalid size")
+	}
+	return int64(f * mult), nil
+}
+
+func (q SearchQuery) Match(e LsEntry) bool {
+	if q.Scope != "/" && !strings.HasPrefix(e.Path, q.Scope) {
+		return false
+	}
+
+	switch q.Mode {
+	case "regex":
+		if !q.re.MatchString(e.Path) {
+			return false
+		}
+	default:
+		subject, pat := e.Name, q.Pattern
+		if q.matchAgainstFullPath {
+			subject = e.Path
+		}
+		if q.IgnoreCase {
+			subject, pat = strings.ToLower(subject), strings.ToLower(pat)
+		}
+		if ok, _ := path.Match(pat, subject); !ok {
+			return false
+		}
+	}
+
+	if q.minSize >= 0 || q.maxSize >= 0 {
+		if e.Type == "dir" {
+			return false
+		}
+		if q.minSize >= 0 && e.Size < q.minSize {
+			return false
+		}
+		if q.maxSize >= 0 && e.Size > q.maxSize {
+			return false
+		}
+	}
+
+	if !q.afterT.IsZero() || !q.beforeT.IsZero() {
+		mt, err := time.Parse(time.RFC3339Nano, e.Mtime)
+		if err != nil {
+			return false
+		}
+		if !q.afterT.IsZero() && mt.Before(q.afterT) {
+			return false
+		}
+		if !q.beforeT.IsZero() && !mt.Before(q.beforeT) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *App) handleSearch(w http.ResponseWriter, r *http.Request) {
+	snap := r.URL.Query().Get("snap")
+	if snap == "" {
+		http.Error(w, "missing snap", 400)
+		return
+	}
+
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	q, err := parseSearchQuery(r.URL.Query())
+	model := SearchPageModel{
+		Title:      "Search",
+		RepoConfig: repo,
+		Snap:       snap,
+		Query:      q,
+	}
+
+	switch {
+	case err != nil:
+		model.Error = err.Error()
+	case q.Pattern != "":
+		model.Searched = true
+		model.Hits, model.Truncated, err = a.searchSnapshot(r.Context(), repo, snap, q)
+		if err != nil {
+			log.Printf("search failed repo=%s snap=%s err=%v", repoID, snap, err)
+			model.Error = fmt.Sprintf("restic ls failed: %v", err)
+		}
+	}
+
+	if err := a.searchTpl.ExecuteTemplate(w, "search.html", model); err != nil {
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+func (a *App) searchSnapshot(ctx context.Context, repo RepoConfig, snap string, q SearchQuery) ([]SearchHit, bool, error) {
+	entries, err := a.listRecursive(ctx, repo, snap)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var hits []SearchHit
+	for _, e := range entries {
+		if !q.Match(e) {
+			continue
+		}
+		if len(hits) >= searchResultLimit {
+			return hits, true, nil
+		}
+		mt, _ := time.Parse(time.RFC3339Nano, e.Mtime)
+		hits = append(hits, SearchHit{
+			LsEntry: e,
+			Dir:     parentPath(e.Path),
+			ModTime: mt,
+		})
+	}
+	return hits, false, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	secretPrefix     = "v1:"
+	kdfIterations    = 600_000
+	keyCheckPlain    = "restic-browser"
+	masterKeyEnv     = "CONFIG_MASTER_KEY"
+	masterKeyFileEnv = "CONFIG_MASTER_KEY_FILE"
+)
+
+var (
+	errMasterKeyMissing = errors.New("master key missing: set " + masterKeyEnv + " or " + masterKeyFileEnv)
+	errWrongMasterKey   = errors.New("master key does not match the one used for this config database")
+)
+
+// loadMasterKey liest den Master Key aus CONFIG_MASTER_KEY oder CONFIG_MASTER_KEY_FILE.
+func loadMasterKey() (string, error) {
+	if k := os.Getenv(masterKeyEnv); k != "" {
+		return k, nil
+	}
+	if f := os.Getenv(masterKeyFileEnv); f != "" {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return "", fmt.Errorf("read master key file: %w", err)
+		}
+		if k := strings.TrimSpace(string(b)); k != "" {
+			return k, nil
+		}
+	}
+	return "", errMasterKeyMissing
+}
+
+// secretBox verschlüsselt Secrets (z.B. Repo-Passwörter) mit AES-256-GCM.
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+func newSecretBox(masterKey string, salt []byte) (*secretBox, error) {
+	key, err := pbkdf2.Key(sha256.New, masterKey, salt, kdfIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead}, nil
+}
+
+func (b *secretBox) Seal(plain string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	ct := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(ct), nil
+}
+
+func (b *secretBox) Open(sealed string) (string, error) {
+	if !strings.HasPrefix(sealed, secretPrefix) {
+		return "", errors.New("secret is not encrypted")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, secretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+	ns := b.aead.NonceSize()
+	if len(raw) < ns {
+		return "", errors.New("secret too short")
+	}
+	plain, err := b.aead.Open(nil, raw[:ns], raw[ns:], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	return string(plain), nil
+}
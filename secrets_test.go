@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+	box, err := newSecretBox("master", []byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"", "secret", "with spaces and ümlauts", strings.Repeat("x", 4096)} {
+		sealed, err := box.Seal(plain)
+		if err != nil {
+			t.Fatalf("Seal(%q): %v", plain, err)
+		}
+		if !strings.HasPrefix(sealed, secretPrefix) {
+			t.Errorf("Seal(%q) = %q, missing prefix %q", plain, sealed, secretPrefix)
+		}
+		if plain != "" && strings.Contains(sealed, plain) {
+			t.Errorf("Seal(%q) contains the plaintext", plain)
+		}
+		got, err := box.Open(sealed)
+		if err != nil {
+			t.Fatalf("Open(Seal(%q)): %v", plain, err)
+		}
+		if got != plain {
+			t.Errorf("Open(Seal(%q)) = %q", plain, got)
+		}
+	}
+}
+
+func TestSecretBoxOpenFails(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	box, err := newSecretBox("master", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.Seal("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := newSecretBox("other", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSalt, err := newSecretBox("master", []byte("fedcba9876543210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		box    *secretBox
+		sealed string
+	}{
+		{"wrong master key", otherKey, sealed},
+		{"wrong salt", otherSalt, sealed},
+		{"plaintext", box, "secret"},
+		{"bad base64", box, secretPrefix + "!!!"},
+		{"too short", box, secretPrefix + "AAAA"},
+		{"tampered", box, sealed[:len(sealed)-4] + "AAAA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.box.Open(tt.sealed); err == nil {
+				t.Errorf("Open(%q) = %q, want error", tt.sealed, got)
+			}
+		})
+	}
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	file := t.TempDir() + "/key"
+	if err := os.WriteFile(file, []byte("  from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	empty := t.TempDir() + "/empty"
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		env, file string
+		want      string
+		wantErr   error
+	}{
+		{name: "env", env: "from-env", file: file, want: "from-env"},
+		{name: "file", file: file, want: "from-file"},
+		{name: "empty file", file: empty, wantErr: errMasterKeyMissing},
+		{name: "none", wantErr: errMasterKeyMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(masterKeyEnv, tt.env)
+			t.Setenv(masterKeyFileEnv, tt.file)
+			got, err := loadMasterKey()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("loadMasterKey() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("loadMasterKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
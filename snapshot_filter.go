@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SnapshotFilter schränkt eine Snapshot-Liste nach Host, Tag, Pfad und Zeitraum ein.
+// Die Felder entsprechen den Query-Parametern host, tag, path, from und to.
+type SnapshotFilter struct {
+	Host string
+	Tag  string
+	Path string // einer der gesicherten Pfade, wie "restic snapshots --path"
+	From string // YYYY-MM-DD, inklusive
+	To   string // YYYY-MM-DD, inklusive
+
+	fromT, toT time.Time
+}
+
+func parseSnapshotFilter(v url.Values) (SnapshotFilter, error) {
+	f := SnapshotFilter{
+		Host: strings.TrimSpace(v.Get("host")),
+		Tag:  strings.TrimSpace(v.Get("tag")),
+		Path: strings.TrimSpace(v.Get("path")),
+		From: strings.TrimSpace(v.Get("from")),
+		To:   strings.TrimSpace(v.Get("to")),
+	}
+
+	var err error
+	if f.From != "" {
+		if f.fromT, err = time.ParseInLocation("2006-01-02", f.From, time.Local); err != nil {
+			return f, fmt.Errorf("from: %w", err)
+		}
+	}
+	if f.To != "" {
+		if f.toT, err = time.ParseInLocation("2006-01-02", f.To, time.Local); err != nil {
+			return f, fmt.Errorf("to: %w", err)
+		}
+		f.toT = f.toT.AddDate(0, 0, 1)
+	}
+	return f, nil
+}
+
+func (f SnapshotFilter) IsZero() bool {
+	return f.Host == "" && f.Tag == "" && f.Path == "" && f.From == "" && f.To == ""
+}
+
+func (f SnapshotFilter) Match(s Snapshot) bool {
+	if f.Host != "" && s.Hostname != f.Host {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(s.Tags, f.Tag) {
+		return false
+	}
+	if f.Path != "" && !slices.Contains(s.Paths, f.Path) {
+		return false
+	}
+	if !f.fromT.IsZero() && s.Time.Before(f.fromT) {
+		return false
+	}
+	if !f.toT.IsZero() && !s.Time.Before(f.toT) {
+		return false
+	}
+	return true
+}
+
+func (f SnapshotFilter) Apply(snaps []Snapshot) []Snapshot {
+	if f.IsZero() {
+		return snaps
+	}
+	out := make([]Snapshot, 0, len(snaps))
+	for _, s := range snaps {
+		if f.Match(s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// snapshotHosts, snapshotTags und snapshotPaths liefern die Auswahlwerte für Filter-Dropdowns.
+func snapshotHosts(snaps []Snapshot) []string {
+	var out []string
+	for _, s := range snaps {
+		if s.Hostname != "" && !slices.Contains(out, s.Hostname) {
+			out = append(out, s.Hostname)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func snapshotTags(snaps []Snapshot) []string {
+	var out []string
+	for _, s := range snaps {
+		for _, t := range s.Tags {
+			if !slices.Contains(out, t) {
+				out = append(out, t)
+			}
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func snapshotPaths(snaps []Snapshot) []string {
+	var out []string
+	for _, s := range snaps {
+		for _, p := range s.Paths {
+			if !slices.Contains(out, p) {
+				out = append(out, p)
+			}
+		}
+	}
+	slices.Sort(out)
+	return out
+}
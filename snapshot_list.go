@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSnapshotsPerPage = 50
+	maxSnapshotsPerPage     = 500
+)
+
+var snapshotsPerPageOptions = []int{25, 50, 100, 200}
+
+// snapshotGroupFields sind die erlaubten Werte für group, kommagetrennt
+// wie bei "restic snapshots --group-by host,paths".
+var snapshotGroupFields = []string{"host", "paths", "tags"}
+
+var snapshotGroupOptions = []string{"host", "paths", "tags", "host,paths", "host,tags", "host,paths,tags"}
+
+// SnapshotGroup fasst Snapshots mit gleichem Host/Pfaden/Tags zusammen.
+// Nur die Felder aus group sind gesetzt.
+type SnapshotGroup struct {
+	Host      string
+	Paths     []string
+	Tags      []string
+	Total     int // Snapshots der Gruppe über alle Seiten
+	Snapshots []Snapshot
+
+	by []string
+}
+
+func (g SnapshotGroup) Has(field string) bool { return slices.Contains(g.by, field) }
+
+// Pager beschreibt eine Seite der (gefilterten) Snapshot-Liste.
+type Pager struct {
+	Page, Pages int
+	PerPage     int
+	Total       int
+	First, Last int // 1-basiert, für "21–40 of 1234"
+
+	Prev, Next string
+	Links      []PageLink
+}
+
+// PageLink ist ein Eintrag der Seitenleiste, Gap steht für "…".
+type PageLink struct {
+	N      int
+	URL    string
+	Active bool
+	Gap    bool
+}
+
+func parseSnapshotGroup(raw string) ([]string, error) {
+	var out []string
+	for f := range strings.SplitSeq(raw, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !slices.Contains(snapshotGroupFields, f) {
+			return nil, fmt.Errorf("group: unknown field %q (allowed: %s)", f, strings.Join(snapshotGroupFields, ", "))
+		}
+		if !slices.Contains(out, f) {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+func snapshotGroupKey(s Snapshot, by []string) string {
+	var b strings.Builder
+	for _, f := range by {
+		switch f {
+		case "host":
+			b.WriteString(s.Hostname)
+		case "paths":
+			p := slices.Clone(s.Paths)
+			slices.Sort(p)
+			b.WriteString(strings.Join(p, "\x00"))
+		case "tags":
+			t := slices.Clone(s.Tags)
+			slices.Sort(t)
+			b.WriteString(strings.Join(t, "\x00"))
+		}
+		b.WriteByte('\x01')
+	}
+	return b.String()
+}
+
+// groupSnapshots gruppiert page in der Reihenfolge des ersten Auftretens, die
+// Liste ist neueste zuerst, also steht die Gruppe mit dem jüngsten Snapshot oben.
+// all liefert die Gesamtzahl je Gruppe, auch wenn page nur einen Ausschnitt zeigt.
+func groupSnapshots(all, page []Snapshot, by []string) []SnapshotGroup {
+	if len(by) == 0 {
+		return []SnapshotGroup{{Total: len(all), Snapshots: page}}
+	}
+
+	totals := map[string]int{}
+	for _, s := range all {
+		totals[snapshotGroupKey(s, by)]++
+	}
+
+	var out []SnapshotGroup
+	idx := map[string]int{}
+	for _, s := range page {
+		k := snapshotGroupKey(s, by)
+		i, ok := idx[k]
+		if !ok {
+			g := SnapshotGroup{Total: totals[k], by: by}
+			for _, f := range by {
+				switch f {
+				case "host":
+					g.Host = s.Hostname
+				case "paths":
+					g.Paths = slices.Sorted(slices.Values(s.Paths))
+				case "tags":
+					g.Tags = slices.Sorted(slices.Values(s.Tags))
+				}
+			}
+			i = len(out)
+			idx[k] = i
+			out = append(out, g)
+		}
+		out[i].Snapshots = append(out[i].Snapshots, s)
+	}
+	return out
+}
+
+// paginate schneidet eine Seite aus snaps. page und per_page kommen aus der
+// Query, ungültige Werte fallen auf Seite 1 bzw. den Default zurück.
+func paginate(snaps []Snapshot, q url.Values) ([]Snapshot, Pager) {
+	perPage, err := strconv.Atoi(q.Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = defaultSnapshotsPerPage
+	}
+	perPage = min(perPage, maxSnapshotsPerPage)
+
+	p := Pager{PerPage: perPage, Total: len(snaps)}
+	p.Pages = max(1, (len(snaps)+perPage-1)/perPage)
+
+	p.Page, err = strconv.Atoi(q.Get("page"))
+	if err != nil || p.Page < 1 {
+		p.Page = 1
+	}
+	p.Page = min(p.Page, p.Pages)
+
+	start := (p.Page - 1) * perPage
+	end := min(start+perPage, len(snaps))
+	if start < end {
+		p.First, p.Last = start+1, end
+	}
+
+	pageURL := func(n int) string {
+		v := url.Values{}
+		for k, vals := range q {
+			v[k] = vals
+		}
+		if n == 1 {
+			v.Del("page")
+		} else {
+			v.Set("page", strconv.Itoa(n))
+		}
+		return "?" + v.Encode()
+	}
+	if p.Page > 1 {
+		p.Prev = pageURL(p.Page - 1)
+	}
+	if p.Page < p.Pages {
+		p.Next = pageURL(p.Page + 1)
+	}
+
+	// erste, letzte und zwei Seiten um die aktuelle herum
+	gap := false
+	for n := 1; n <= p.Pages; n++ {
+		if n == 1 || n == p.Pages || (n >= p.Page-2 && n <= p.Page+2) {
+			p.Links = append(p.Links, PageLink{N: n, URL: pageURL(n), Active: n == p.Page})
+			gap = false
+		} else if !gap {
+			p.Links = append(p.Links, PageLink{Gap: true})
+			gap = true
+		}
+	}
+
+	return snaps[start:end], p
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RepoStats fasst "restic stats" (restore-size und raw-data) und die
+// Snapshot-Liste eines Repositories zusammen.
+type RepoStats struct {
+	Snapshots int       `json:"snapshots"`
+	First     time.Time `json:"first"`
+	Last      time.Time `json:"last"`
+
+	RestoreSize  int64 `json:"restore_size"` // Summe aller Snapshots, so groß wäre ein Restore von allem
+	RestoreFiles int64 `json:"restore_files"`
+	RawSize      int64 `json:"raw_size"`              // tatsächlich belegter Platz im Repository
+	RawSizeFull  int64 `json:"raw_size_uncompressed"` // ohne Kompression
+	Blobs        int64 `json:"blobs"`
+
+	DedupRatio       float64 `json:"dedup_ratio"` // RestoreSize / RawSizeFull
+	CompressionRatio float64 `json:"compression_ratio"`
+
+	Hosts  []StatCount   `json:"hosts"`
+	Tags   []StatCount   `json:"tags"`
+	Growth []GrowthPoint `json:"growth"`
+
+	HasSummary bool      `json:"has_summary"` // Snapshots enthalten data_added (restic >= 0.17)
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+type StatCount struct {
+	Name    string `json:"name"`
+	Count   int    `json:"count"`
+	Percent int    `json:"percent"`
+}
+
+// GrowthPoint ist ein Monat: neue Daten und Größe des letzten Snapshots.
+type GrowthPoint struct {
+	Month     string `json:"month"`
+	Snapshots int    `json:"snapshots"`
+	DataAdded int64  `json:"data_added"` // gepackt, also wirklicher Zuwachs im Repository
+	Size      int64  `json:"size"`       // total_bytes_processed des letzten Snapshots im Monat
+	Percent   int    `json:"percent"`    // DataAdded relativ zum größten Monat
+}
+
+type StatsPageModel struct {
+	Title      string
+	RepoConfig RepoConfig
+	Stats      RepoStats
+}
+
+// statsCache hält die Statistik je Repository, bis sich die Snapshots ändern.
+// "restic stats --mode restore-size" liest alle Trees und ist entsprechend teuer.
+type statsCache struct {
+	mu    sync.Mutex
+	items map[string]statsCacheItem
+}
+
+type statsCacheItem struct {
+	fingerprint string
+	stats       RepoStats
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{items: map[string]statsCacheItem{}}
+}
+
+// Purge vergisst die Statistik eines Repositories (geändert oder gelöscht).
+func (c *statsCache) Purge(repoID string) {
+	c.mu.Lock()
+	delete(c.items, repoID)
+	c.mu.Unlock()
+}
+
+func snapshotsFingerprint(snaps []Snapshot) string {
+	ids := make([]string, len(snaps))
+	for i, s := range snaps {
+		ids[i] = s.ID
+	}
+	sort.Strings(ids)
+	return contentHash(ids)
+}
+
+// repoStats liefert die Statistik aus dem Cache oder berechnet sie neu.
+func (a *App) repoStats(ctx context.Context, repo RepoConfig, snaps []Snapshot, refresh bool) (RepoStats, error) {
+	fp := snapshotsFingerprint(snaps)
+
+	a.stats.mu.Lock()
+	item, ok := a.stats.items[repo.ID]
+	a.stats.mu.Unlock()
+	if ok && !refresh && item.fingerprint == fp {
+		return item.stats, nil
+	}
+
+	st := snapshotStats(snaps)
+
+	restore, err := ResticStats(ctx, repo, "restore-size")
+	if err != nil {
+		return RepoStats{}, fmt.Errorf("restic stats --mode restore-size: %w", err)
+	}
+	raw, err := ResticStats(ctx, repo, "raw-data")
+	if err != nil {
+		return RepoStats{}, fmt.Errorf("restic stats --mode raw-data: %w", err)
+	}
+
+	st.RestoreSize = restore.TotalSize
+	st.RestoreFiles = restore.TotalFileCount
+	st.RawSize = raw.TotalSize
+	st.RawSizeFull = raw.TotalUncompressedSize
+	if st.RawSizeFull == 0 {
+		// Repository ohne Kompression (v1)
+		st.RawSizeFull = raw.TotalSize
+	}
+	st.Blobs = raw.TotalBlobCount
+	st.CompressionRatio = raw.CompressionRatio
+	if st.RawSizeFull > 0 {
+		st.DedupRatio = float64(st.RestoreSize) / float64(st.RawSizeFull)
+	}
+	st.ComputedAt = time.Now()
+
+	a.stats.mu.Lock()
+	a.stats.items[repo.ID] = statsCacheItem{fingerprint: fp, stats: st}
+	a.stats.mu.Unlock()
+	return st, nil
+}
+
+// snapshotStats wertet nur die Snapshot-Liste aus, ohne restic-Aufruf.
+func snapshotStats(snaps []Snapshot) RepoStats {
+	st := RepoStats{Snapshots: len(snaps)}
+
+	hosts := map[string]int{}
+	tags := map[string]int{}
+	months := map[string]*GrowthPoint{}
+	lastInMonth := map[string]time.Time{}
+
+	for _, s := range snaps {
+		if st.First.IsZero() || s.Time.Before(st.First) {
+			st.First = s.Time
+		}
+		if s.Time.After(st.Last) {
+			st.Last = s.Time
+		}
+
+		hosts[s.Hostname]++
+		if len(s.Tags) == 0 {
+			tags[""]++
+		}
+		for _, t := range s.Tags {
+			tags[t]++
+		}
+
+		m := s.Time.Format("2006-01")
+		g, ok := months[m]
+		if !ok {
+			g = &GrowthPoint{Month: m}
+			months[m] = g
+		}
+		g.Snapshots++
+		if s.Summary != nil {
+			st.HasSummary = true
+			g.DataAdded += s.Summary.DataAddedPacked
+			if s.Time.After(lastInMonth[m]) {
+				lastInMonth[m] = s.Time
+				g.Size = s.Summary.TotalBytesProcessed
+			}
+		}
+	}
+
+	st.Hosts = statCounts(hosts, len(snaps))
+	st.Tags = statCounts(tags, len(snaps))
+
+	var maxAdded int64
+	for _, g := range months {
+		st.Growth = append(st.Growth, *g)
+		maxAdded = max(maxAdded, g.DataAdded)
+	}
+	sort.Slice(st.Growth, func(i, j int) bool { return st.Growth[i].Month < st.Growth[j].Month })
+	for i := range st.Growth {
+		if maxAdded > 0 {
+			st.Growth[i].Percent = int(st.Growth[i].DataAdded * 100 / maxAdded)
+		}
+	}
+	return st
+}
+
+func statCounts(m map[string]int, total int) []StatCount {
+	out := make([]StatCount, 0, len(m))
+	for name, n := range m {
+		c := StatCount{Name: name, Count: n}
+		if total > 0 {
+			c.Percent = n * 100 / total
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func (a *App) handleStats(w http.ResponseWriter, r *http.Request) {
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	snaps, err := ResticSnapshots(r.Context(), repo)
+	if recErr := a.store.RecordAccess(r.Context(), repoID, err); recErr != nil {
+		log.Printf("record access repo=%s err=%v", repoID, recErr)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("restic snapshots failed: %v", err), 500)
+		return
+	}
+
+	st, err := a.repoStats(r.Context(), repo, snaps, r.URL.Query().Get("refresh") != "")
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	m := StatsPageModel{Title: "Statistics", RepoConfig: repo, Stats: st}
+	if err := a.statsTpl.ExecuteTemplate(w, "stats.html", m); err != nil {
+		http.Error(w, fmt.Sprintf("template error: %v", err), 500)
+	}
+}
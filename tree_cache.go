@@ -0,0 +1,371 @@
+package main
+
+import (
+	"compress/gzip"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Anzahl Snapshot-Bäume im Speicher, per TREE_CACHE_SIZE änderbar
+const defaultTreeCacheSize = 8
+
+// Nur vollständige Snapshot-IDs sind unveränderlich; "latest" oder Kurz-IDs
+// werden nie gecacht.
+var fullSnapshotID = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// SnapshotTree ist das Ergebnis eines einzigen rekursiven "restic ls" und
+// beantwortet danach alle Ordner-Listings ohne weiteren restic-Aufruf.
+type SnapshotTree struct {
+	Entries  []LsEntry
+	byPath   map[string]int
+	children map[string][]int // Ordnerpfad ohne trailing "/" ("/" = root)
+}
+
+func newSnapshotTree(entries []LsEntry) *SnapshotTree {
+	t := &SnapshotTree{
+		Entries:  entries,
+		byPath:   make(map[string]int, len(entries)),
+		children: map[string][]int{},
+	}
+	for i, e := range entries {
+		t.byPath[e.Path] = i
+		dir := path.Dir(e.Path)
+		t.children[dir] = append(t.children[dir], i)
+	}
+	return t
+}
+
+func treeDirKey(dir string) string {
+	if dir = strings.TrimSuffix(dir, "/"); dir == "" {
+		return "/"
+	}
+	return dir
+}
+
+// List entspricht "restic ls <snap> <dir>": der Ordner selbst (außer root) und
+// seine direkten Kinder.
+func (t *SnapshotTree) List(dir string) []LsEntry {
+	dir = treeDirKey(dir)
+	var out []LsEntry
+	if i, ok := t.byPath[dir]; ok {
+		out = append(out, t.Entries[i])
+	}
+	for _, i := range t.children[dir] {
+		out = append(out, t.Entries[i])
+	}
+	return out
+}
+
+func (t *SnapshotTree) Lookup(p string) (LsEntry, bool) {
+	i, ok := t.byPath[treeDirKey(p)]
+	if !ok {
+		return LsEntry{}, false
+	}
+	return t.Entries[i], true
+}
+
+// treeCache hält Snapshot-Bäume im Speicher (LRU) und optional gzip-komprimiert
+// auf der Platte, Schlüssel ist Repo-ID + Snapshot-ID. Auf der Platte liegt je
+// Repository ein Ordner, Ordner- und Dateinamen sind Hashes der IDs.
+type treeCache struct {
+	mu       sync.Mutex
+	max      int
+	dir      string // "" = kein Disk-Cache
+	items    map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*treeLoad
+}
+
+type treeCacheItem struct {
+	key    string
+	repoID string
+	tree   *SnapshotTree
+}
+
+// treeLoad ist ein laufendes "restic ls". Es hat einen eigenen Context, damit ein
+// abgebrochener Request nicht die Anfragen abbricht, die auf dasselbe Ergebnis
+// warten; erst wenn keiner mehr wartet, wird restic beendet.
+type treeLoad struct {
+	repoID  string
+	done    chan struct{}
+	tree    *SnapshotTree
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newTreeCache(max int, dir string) *treeCache {
+	if max < 1 {
+		max = 1
+	}
+	return &treeCache{
+		max:      max,
+		dir:      dir,
+		items:    map[string]*list.Element{},
+		lru:      list.New(),
+		inflight: map[string]*treeLoad{},
+	}
+}
+
+// treeCacheFromEnv liest TREE_CACHE_SIZE und TREE_CACHE_DISK. Der Disk-Cache
+// liegt neben der SQLite DB im Ordner "tree-cache".
+func treeCacheFromEnv(dbPath string) *treeCache {
+	size := defaultTreeCacheSize
+	if v := os.Getenv("TREE_CACHE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			size = n
+		} else {
+			log.Printf("WARN: invalid TREE_CACHE_SIZE=%q, using %d", v, size)
+		}
+	}
+
+	dir := ""
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("TREE_CACHE_DISK"))) {
+	case "1", "true", "yes", "on":
+		dir = filepath.Join(filepath.Dir(dbPath), "tree-cache")
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			log.Printf("WARN: tree cache dir %s not usable, disk cache disabled: %v", dir, err)
+			dir = ""
+		}
+	}
+	return newTreeCache(size, dir)
+}
+
+func treeCacheKey(repoID, snap string) string {
+	return repoID + "\x00" + snap
+}
+
+func (c *treeCache) Get(ctx context.Context, repo RepoConfig, snap string) (*SnapshotTree, error) {
+	key := treeCacheKey(repo.ID, snap)
+
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*treeCacheItem).tree, nil
+	}
+	// Gleichzeitige Anfragen für denselben Snapshot teilen sich einen restic-Aufruf
+	l, ok := c.inflight[key]
+	if !ok {
+		loadCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		l = &treeLoad{repoID: repo.ID, done: make(chan struct{}), cancel: cancel}
+		c.inflight[key] = l
+		go c.run(loadCtx, l, repo, snap, key)
+	}
+	l.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return l.tree, l.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		if l.waiters--; l.waiters == 0 {
+			l.cancel()
+			if c.inflight[key] == l {
+				delete(c.inflight, key)
+			}
+		}
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Cached liefert einen Baum nur, wenn er schon im Speicher liegt, ohne restic
+// zu starten.
+func (c *treeCache) Cached(repoID, snap string) (*SnapshotTree, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[treeCacheKey(repoID, snap)]
+	if !ok {
+		return nil, false
+	}
+	return el.Value.(*treeCacheItem).tree, true
+}
+
+func (c *treeCache) run(ctx context.Context, l *treeLoad, repo RepoConfig, snap, key string) {
+	defer l.cancel()
+	l.tree, l.err = c.load(ctx, repo, snap)
+
+	c.mu.Lock()
+	// Purge während des Ladens: Ergebnis verwerfen
+	if c.inflight[key] == l {
+		delete(c.inflight, key)
+		if l.err == nil {
+			c.add(key, repo.ID, l.tree)
+		}
+	}
+	c.mu.Unlock()
+	close(l.done)
+}
+
+// Purge entfernt alle Bäume eines Repositories aus Speicher und Platte.
+func (c *treeCache) Purge(repoID string) {
+	c.mu.Lock()
+	for key, el := range c.items {
+		if el.Value.(*treeCacheItem).repoID == repoID {
+			c.lru.Remove(el)
+			delete(c.items, key)
+		}
+	}
+	for key, l := range c.inflight {
+		if l.repoID == repoID {
+			l.cancel()
+			delete(c.inflight, key)
+		}
+	}
+	c.mu.Unlock()
+
+	if c.dir != "" {
+		if err := os.RemoveAll(c.repoDir(repoID)); err != nil {
+			log.Printf("tree cache: purge %s failed: %v", repoID, err)
+		}
+	}
+}
+
+func (c *treeCache) add(key, repoID string, tree *SnapshotTree) {
+	c.items[key] = c.lru.PushFront(&treeCacheItem{key: key, repoID: repoID, tree: tree})
+	for c.lru.Len() > c.max {
+		old := c.lru.Back()
+		c.lru.Remove(old)
+		delete(c.items, old.Value.(*treeCacheItem).key)
+	}
+}
+
+func (c *treeCache) load(ctx context.Context, repo RepoConfig, snap string) (*SnapshotTree, error) {
+	file := c.diskPath(repo.ID, snap)
+	if c.dir != "" {
+		if entries, err := c.readDisk(file); err == nil {
+			return newSnapshotTree(entries), nil
+		} else if !os.IsNotExist(err) {
+			log.Printf("tree cache: read %s failed: %v", file, err)
+		}
+	}
+
+	entries, err := ResticListRecursive(ctx, repo, snap)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.dir != "" {
+		if err := c.writeDisk(file, entries); err != nil {
+			log.Printf("tree cache: write %s failed: %v", file, err)
+		}
+	}
+	return newSnapshotTree(entries), nil
+}
+
+// Repo-IDs und Snapshot-IDs kommen aus Konfiguration bzw. URL, als Dateinamen
+// werden nur ihre Hashes verwendet.
+func (c *treeCache) repoDir(repoID string) string {
+	return filepath.Join(c.dir, contentHash([]string{repoID}))
+}
+
+func (c *treeCache) diskPath(repoID, snap string) string {
+	return filepath.Join(c.repoDir(repoID), contentHash([]string{repoID, snap})+".json.gz")
+}
+
+func (c *treeCache) readDisk(file string) ([]LsEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var entries []LsEntry
+	if err := json.NewDecoder(zr).Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (c *treeCache) writeDisk(file string, entries []LsEntry) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	if err := json.NewEncoder(zw).Encode(entries); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// -------------------- Zugriff für die Handler --------------------
+
+// listDir liefert ein Ordner-Listing, bei vollständiger Snapshot-ID aus dem Cache.
+func (a *App) listDir(ctx context.Context, repo RepoConfig, snap, dir string) ([]LsEntry, error) {
+	if !fullSnapshotID.MatchString(snap) {
+		return ResticList(ctx, repo, snap, dir)
+	}
+	tree, err := a.trees.Get(ctx, repo, snap)
+	if err != nil {
+		return nil, err
+	}
+	return tree.List(dir), nil
+}
+
+// listRecursive liefert alle Einträge eines Snapshots.
+func (a *App) listRecursive(ctx context.Context, repo RepoConfig, snap string) ([]LsEntry, error) {
+	if !fullSnapshotID.MatchString(snap) {
+		return ResticListRecursive(ctx, repo, snap)
+	}
+	tree, err := a.trees.Get(ctx, repo, snap)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Entries, nil
+}
+
+// lookupEntry sucht den ls-Eintrag einer Datei oder eines Ordners.
+func (a *App) lookupEntry(ctx context.Context, repo RepoConfig, snap, p string) (LsEntry, bool, error) {
+	p = "/" + strings.Trim(p, "/")
+	if fullSnapshotID.MatchString(snap) {
+		tree, err := a.trees.Get(ctx, repo, snap)
+		if err != nil {
+			return LsEntry{}, false, err
+		}
+		e, ok := tree.Lookup(p)
+		return e, ok, nil
+	}
+
+	entries, err := ResticList(ctx, repo, snap, parentPath(p))
+	if err != nil {
+		return LsEntry{}, false, fmt.Errorf("restic ls: %w", err)
+	}
+	for _, e := range entries {
+		if e.Path == p {
+			return e, true, nil
+		}
+	}
+	return LsEntry{}, false, nil
+}
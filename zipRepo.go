@@ -1,16 +1,34 @@
 package main
 
 import (
-	"archive/zip"
+	"archive/tar"
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"path"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 )
 
 func (a *App) handleDownloadZip(w http.ResponseWriter, r *http.Request) {
+	a.serveFolderArchive(w, r, "zip")
+}
+
+// handleDownloadArchive liefert einen Ordner als zip, tar, tar.gz oder tar.zst.
+func (a *App) handleDownloadArchive(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	a.serveFolderArchive(w, r, format)
+}
+
+func (a *App) serveFolderArchive(w http.ResponseWriter, r *http.Request, format string) {
 	snap := r.URL.Query().Get("snap")
 	p := r.URL.Query().Get("path")
 	if snap == "" {
@@ -19,21 +37,21 @@ func (a *App) handleDownloadZip(w http.ResponseWriter, r *http.Request) {
 	}
 	p = normalizeDirPath(p)
 
-	filename := "folder.zip"
+	af, ok := archiveFormats[format]
+	if !ok {
+		http.Error(w, "unknown format (zip, tar, tar.gz, tar.zst)", 400)
+		return
+	}
+
+	filename := "folder" + af.Ext
 	if p != "/" {
 		filename = strings.Trim(path.Base(strings.Trim(p, "/")), " ")
 		if filename == "" {
 			filename = "folder"
 		}
-		filename += ".zip"
+		filename += af.Ext
 	}
 
-	w.Header().Set("Content-Type", "application/zip")
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
-
-	zw := zip.NewWriter(w)
-	defer zw.Close()
-
 	base := strings.TrimSuffix(p, "/") // z.B. "/userdata"
 	if base == "" {
 		base = "/"
@@ -41,69 +59,423 @@ func (a *App) handleDownloadZip(w http.ResponseWriter, r *http.Request) {
 
 	repoID := strings.ToUpper(r.PathValue("repo"))
 	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
 	if !ok {
 		http.NotFound(w, r)
 		return
 	}
+
+	w.Header().Set("Content-Type", af.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	sink, err := newArchiveSink(af.Name, w)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("error in loading connfig: %v", err), 500)
+		http.Error(w, err.Error(), 500)
 		return
 	}
+	defer sink.Close()
 
-	if err := zipDirFromRestic(r.Context(), repo, zw, snap, p, base); err != nil {
+	if err := a.archiveDirFromRestic(r.Context(), repo, sink, snap, p, base); err != nil {
 		// Wenn schon gestreamt wird: nur loggen
-		log.Printf("zip download failed: %v", err)
+		log.Printf("%s download failed: %v", format, err)
 		return
 	}
 }
 
 // p muss ein Ordnerpfad mit trailing "/" sein.
-// base ist der "root" der ZIP relativen Pfade.
-func zipDirFromRestic(ctx context.Context, repo RepoConfig, zw *zip.Writer, snap, p, base string) error {
-	entries, err := ResticList(ctx, repo, snap, strings.TrimSuffix(p, "/"))
-	if err != nil {
-		return err
+// base ist der "root" der relativen Pfade im Archiv.
+//
+// Statt pro Ordner "restic ls" und pro Datei "restic dump" aufzurufen, liefert
+// ein einziges "restic dump --archive tar" den ganzen Ordner; die tar Einträge
+// werden beim Lesen umbenannt und direkt an das Zielformat weitergereicht.
+func (a *App) archiveDirFromRestic(ctx context.Context, repo RepoConfig, sink archiveSink, snap, p, base string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dir := strings.TrimSuffix(p, "/")
+	if dir == "" {
+		dir = "/"
 	}
 
-	for _, e := range entries {
-		// ResticList gibt bei ls <dir> auch den dir-node selbst mit zurück (je nach Version).
-		// Wir überspringen den Knoten, der genau dem angefragten Pfad entspricht.
-		if normalizeDirPath(e.Path) == normalizeDirPath(p) {
-			continue
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(ResticDumpArchive(ctx, repo, snap, dir, "tar", pw))
+	}()
+
+	tr := tar.NewReader(pr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
 
-		if e.Type == "dir" {
-			// Rekursion: dir path als ".../"
-			if err := zipDirFromRestic(ctx, repo, zw, snap, normalizeDirPath(e.Path), base); err != nil {
-				return err
-			}
+		rel := archiveRelPath(hdr.Name, base)
+		if rel == "" {
 			continue
 		}
+		if hdr.Typeflag == tar.TypeDir {
+			rel += "/"
+		}
+		hdr.Name = rel
 
-		// Datei
-		rel := e.Path
-		if base != "/" && strings.HasPrefix(rel, base+"/") {
-			rel = strings.TrimPrefix(rel, base+"/")
-		} else if base == "/" && strings.HasPrefix(rel, "/") {
-			rel = strings.TrimPrefix(rel, "/")
+		if err := sink.Add(hdr, tr); err != nil {
+			return err
 		}
+	}
+}
 
-		fh := &zip.FileHeader{
-			Name:   rel,
-			Method: zip.Deflate,
+// archiveRelPath macht aus einem Namen im restic tar (relativ zu "/", z.B.
+// "home/user/file") einen Pfad relativ zu base.
+func archiveRelPath(name, base string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	b := strings.Trim(base, "/")
+	if b == "" {
+		return name
+	}
+	if name == b {
+		return ""
+	}
+	return strings.TrimPrefix(name, b+"/")
+}
+
+// handleDownloadSelected packt mehrere ausgewählte Dateien und Ordner aus einem
+// Snapshot in ein Archiv. Die Namen im Archiv sind relativ zum gemeinsamen
+// Elternordner der Auswahl.
+func (a *App) handleDownloadSelected(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", 400)
+		return
+	}
+	snap := r.FormValue("snap")
+	if snap == "" {
+		http.Error(w, "missing snap", 400)
+		return
+	}
+	paths := selectionRoots(r.Form["path"])
+	if len(paths) == 0 {
+		http.Error(w, "nothing selected", 400)
+		return
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = "zip"
+	}
+	af, ok := archiveFormats[format]
+	if !ok {
+		http.Error(w, "unknown format (zip, tar, tar.gz, tar.zst)", 400)
+		return
+	}
+
+	repoID := strings.ToUpper(r.PathValue("repo"))
+	repo, ok, err := a.store.GetRepo(r.Context(), repoID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error in loading config: %v", err), 500)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Typ, Größe und mtime vorab nachschlagen, damit Fehler noch als 4xx/5xx
+	// gemeldet werden können, bevor der Download startet.
+	entries, missing, err := a.lookupSelection(r.Context(), repo, snap, paths)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if missing != "" {
+		http.Error(w, "not found in snapshot: "+missing, 404)
+		return
+	}
+
+	// Große Auswahl lieber als Job bauen, der Download kommt dann von /jobs
+	if r.FormValue("background") != "" {
+		j, err := a.jobs.Submit(r.Context(), "archive", repo.ID, JobParams{Snap: snap, Paths: paths, Format: af.Name})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("submit job failed: %v", err), 500)
+			return
 		}
-		// Optional: mtime, permissions etc. könntest du aus e.Mtime / e.Mode setzen
+		http.Redirect(w, r, "/jobs/"+j.ID, http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Content-Type", af.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, selectionFilename(snap, af)))
 
-		zf, err := zw.CreateHeader(fh)
+	sink, err := newArchiveSink(af.Name, w)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer sink.Close()
+
+	if err := a.writeSelection(r.Context(), repo, sink, snap, entries, selectionBase(paths)); err != nil {
+		log.Printf("%s download of selection failed: %v", format, err)
+	}
+}
+
+func selectionFilename(snap string, af archiveFormat) string {
+	if len(snap) >= 8 {
+		return "selection-" + snap[:8] + af.Ext
+	}
+	return "selection" + af.Ext
+}
+
+// lookupSelection sucht die ls-Einträge der Auswahl; missing ist der erste
+// Pfad, der im Snapshot nicht existiert.
+func (a *App) lookupSelection(ctx context.Context, repo RepoConfig, snap string, paths []string) ([]LsEntry, string, error) {
+	entries := make([]LsEntry, 0, len(paths))
+	for _, p := range paths {
+		e, found, err := a.lookupEntry(ctx, repo, snap, p)
 		if err != nil {
-			return err
+			return nil, "", err
+		}
+		if !found {
+			return nil, p, nil
 		}
+		entries = append(entries, e)
+	}
+	return entries, "", nil
+}
 
-		// restic dump direkt in den ZIP entry streamen
-		if err := ResticDumpToWriter(ctx, repo, snap, e.Path, zf); err != nil {
-			return err
+func (a *App) writeSelection(ctx context.Context, repo RepoConfig, sink archiveSink, snap string, entries []LsEntry, base string) error {
+	// Geräte, FIFOs usw. nicht stillschweigend weglassen; prüfen, bevor etwas geschrieben ist
+	var unsupported []string
+	for _, e := range entries {
+		if e.Type != "dir" && e.Type != "file" && e.Type != "symlink" {
+			unsupported = append(unsupported, fmt.Sprintf("%s (%s)", e.Path, e.Type))
 		}
 	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("cannot archive %s", strings.Join(unsupported, ", "))
+	}
 
+	for _, e := range entries {
+		var err error
+		switch e.Type {
+		case "dir":
+			err = a.archiveDirFromRestic(ctx, repo, sink, snap, normalizeDirPath(e.Path), base)
+		case "file":
+			err = a.archiveFileFromRestic(ctx, repo, sink, snap, e, base)
+		case "symlink":
+			err = archiveSymlinkFromRestic(ctx, repo, sink, snap, e, base)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Path, err)
+		}
+	}
 	return nil
 }
+
+// runArchiveJob baut das Archiv einer Auswahl als Datei im Job-Ordner.
+func (a *App) runArchiveJob(ctx context.Context, jc *jobContext) error {
+	j := jc.Job()
+	repo, ok, err := a.store.GetRepo(ctx, j.RepoID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("repository %s is not configured", j.RepoID)
+	}
+	af, ok := archiveFormats[j.Params.Format]
+	if !ok {
+		return fmt.Errorf("unknown archive format %q", j.Params.Format)
+	}
+
+	entries, missing, err := a.lookupSelection(ctx, repo, j.Params.Snap, j.Params.Paths)
+	if err != nil {
+		return err
+	}
+	if missing != "" {
+		return fmt.Errorf("not found in snapshot: %s", missing)
+	}
+
+	// Gesamtgröße für den Fortschritt; aus dem Tree-Cache ist das billig
+	var total int64
+	if all, err := a.listRecursive(ctx, repo, j.Params.Snap); err == nil {
+		for _, e := range all {
+			if e.Type != "file" {
+				continue
+			}
+			for _, sel := range entries {
+				if e.Path == sel.Path || strings.HasPrefix(e.Path, sel.Path+"/") {
+					total += e.Size
+					break
+				}
+			}
+		}
+	}
+	jc.Logf("building %s of %d path(s), %s", af.Name, len(entries), formatBytes(total))
+
+	name := selectionFilename(j.Params.Snap, af)
+	f, err := jc.CreateArtifact(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sink, err := newArchiveSink(af.Name, f)
+	if err != nil {
+		return err
+	}
+	counted := &progressSink{archiveSink: sink, onRead: func(n int64) {
+		frac := 0.0
+		if total > 0 {
+			frac = min(float64(n)/float64(total), 1)
+		}
+		jc.Progress(frac, formatBytes(n)+" of "+formatBytes(total))
+	}}
+
+	if err := a.writeSelection(ctx, repo, counted, j.Params.Snap, entries, selectionBase(j.Params.Paths)); err != nil {
+		sink.Close()
+		return err
+	}
+	if err := sink.Close(); err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	jc.Logf("archive ready: %s (%s)", name, formatBytes(fi.Size()))
+	return jc.FinishArtifact(name, fi.Size())
+}
+
+// progressSink zählt die gelesenen (unkomprimierten) Bytes aller Einträge.
+type progressSink struct {
+	archiveSink
+	n      int64
+	onRead func(n int64)
+}
+
+func (s *progressSink) Add(hdr *tar.Header, r io.Reader) error {
+	if r == nil {
+		return s.archiveSink.Add(hdr, r)
+	}
+	return s.archiveSink.Add(hdr, &countingReader{r: r, fn: func(n int) {
+		s.n += int64(n)
+		s.onRead(s.n)
+	}})
+}
+
+type countingReader struct {
+	r  io.Reader
+	fn func(n int)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.fn(n)
+	}
+	return n, err
+}
+
+// archiveFileFromRestic schreibt eine einzelne Datei; der Header kommt aus dem
+// ls-Eintrag, der Inhalt aus "restic dump".
+func (a *App) archiveFileFromRestic(ctx context.Context, repo RepoConfig, sink archiveSink, snap string, e LsEntry, base string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     archiveRelPath(e.Path, base),
+		Size:     e.Size,
+		Mode:     tarMode(os.FileMode(e.Mode)),
+	}
+	if mt, err := time.Parse(time.RFC3339Nano, e.Mtime); err == nil {
+		hdr.ModTime = mt
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(ResticDumpToWriter(ctx, repo, snap, e.Path, pw))
+	}()
+	return sink.Add(hdr, pr)
+}
+
+// archiveSymlinkFromRestic schreibt einen Symlink wie im Ordner-Archiv; das
+// Linkziel steht nicht im ls-Eintrag, sondern im Tree des Elternordners.
+func archiveSymlinkFromRestic(ctx context.Context, repo RepoConfig, sink archiveSink, snap string, e LsEntry, base string) error {
+	nodes, err := ResticCatTree(ctx, repo, snap, path.Dir(e.Path))
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(nodes, func(n TreeNode) bool { return n.Name == path.Base(e.Path) })
+	if i < 0 || nodes[i].Type != "symlink" {
+		return fmt.Errorf("symlink not found in tree of %s", path.Dir(e.Path))
+	}
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     archiveRelPath(e.Path, base),
+		Linkname: nodes[i].LinkTarget,
+		Mode:     tarMode(os.FileMode(e.Mode)),
+		ModTime:  nodes[i].Mtime,
+	}
+	return sink.Add(hdr, nil)
+}
+
+// tarMode macht aus einem os.FileMode (wie restic ls ihn liefert) den Unix-Modus
+// des tar Headers, inklusive setuid, setgid und sticky.
+func tarMode(m os.FileMode) int64 {
+	mode := int64(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= 0o4000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 0o2000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 0o1000
+	}
+	return mode
+}
+
+// selectionRoots normalisiert die ausgewählten Pfade, entfernt Duplikate und
+// Pfade, die bereits in einem ebenfalls ausgewählten Ordner liegen.
+func selectionRoots(raw []string) []string {
+	var paths []string
+	for _, p := range raw {
+		p = path.Clean("/" + strings.TrimSpace(p))
+		if p == "/" {
+			// root lässt sich nicht benennen, stattdessen Ordner-Download nutzen
+			continue
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var out []string
+	for _, p := range paths {
+		if n := len(out); n > 0 && (out[n-1] == p || strings.HasPrefix(p, out[n-1]+"/")) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// selectionBase ist der gemeinsame Elternordner aller Pfade.
+func selectionBase(paths []string) string {
+	base := strings.Split(strings.Trim(path.Dir(paths[0]), "/"), "/")
+	for _, p := range paths[1:] {
+		parts := strings.Split(strings.Trim(path.Dir(p), "/"), "/")
+		n := 0
+		for n < len(base) && n < len(parts) && base[n] == parts[n] {
+			n++
+		}
+		base = base[:n]
+	}
+	return "/" + strings.Join(base, "/")
+}
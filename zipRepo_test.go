@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTarMode(t *testing.T) {
+	tests := []struct {
+		in   os.FileMode
+		want int64
+	}{
+		{0o644, 0o644},
+		{os.ModeDir | 0o755, 0o755},
+		{os.ModeSetuid | 0o755, 0o4755},
+		{os.ModeSetgid | 0o750, 0o2750},
+		{os.ModeDir | os.ModeSticky | 0o777, 0o1777},
+		{os.ModeSymlink | 0o777, 0o777},
+	}
+	for _, tt := range tests {
+		if got := tarMode(tt.in); got != tt.want {
+			t.Errorf("tarMode(%v) = %o, want %o", tt.in, got, tt.want)
+		}
+	}
+}